@@ -17,22 +17,156 @@ limitations under the License.
 package v1alpha1
 
 import (
-	v1 "k8s.io/api/core/v1"
+	"encoding/json"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	AnalyticReadyCondition = "Ready"
+)
+
+const (
+	NamespacedSinkKind = "NamespacedSink"
+	SinkKind           = "Sink"
+)
+
 // AnalyticSpec defines the desired state of Analytic
 type AnalyticSpec struct {
-	Query   string                  `json:"query"`
-	SinkRef v1.LocalObjectReference `json:"sinkRef"`
+	// Query to run against the events stored in the referenced sink.
+	// +required
+	Query string `json:"query"`
+
+	// SinkRef reference to the sink to run the query against.
+	// +required
+	SinkRef AnalyticSinkReference `json:"sinkRef"`
+
+	// ServiceAccountName name of the service account of the analytic, which
+	// must be allowed to query the cluster sinks it references. Defaults to
+	// the default service account of the namespace.
+	// +optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Interval between query runs, for example 5m. Mutually exclusive with schedule.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// Schedule cron expression of the query runs, for example "0 * * * *".
+	// Mutually exclusive with interval.
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// Window restricts the query to events with a lastTimestamp within the
+	// window before the run time, for example 1h.
+	// +optional
+	Window *metav1.Duration `json:"window,omitempty"`
+
+	// HistoryLimit number of results to keep in the status history, fewer
+	// are kept if their rows exceed 256KiB.
+	// +kubebuilder:default:=10
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	HistoryLimit int `json:"historyLimit,omitempty"`
+
+	// Metric exposes the latest result as a prometheus gauge on the
+	// manager metrics endpoint.
+	// +optional
+	Metric *AnalyticMetric `json:"metric,omitempty"`
+}
+
+type AnalyticSinkReference struct {
+	// Kind of the sink, a NamespacedSink in the namespace of the analytic
+	// or a cluster Sink. Cluster sinks hold the events of all the
+	// namespaces, so they are only queried if the service account of the
+	// analytic is allowed to create their sinks/query subresource.
+	// +kubebuilder:validation:Enum=NamespacedSink;Sink
+	// +kubebuilder:default:=NamespacedSink
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Name of the sink.
+	// +required
+	Name string `json:"name"`
+}
+
+type AnalyticMetric struct {
+	// Name of the gauge, exposed with the "analytics_" prefix. Names
+	// starting with "controller_" are reserved for the controller metrics.
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z_:][a-zA-Z0-9_:]*$`
+	// +required
+	Name string `json:"name"`
+
+	// Help text of the gauge.
+	// +optional
+	Help string `json:"help,omitempty"`
+
+	// ValueColumn result column holding the gauge value.
+	// +required
+	ValueColumn string `json:"valueColumn"`
+
+	// LabelColumns result columns exposed as gauge labels.
+	// +optional
+	LabelColumns []string `json:"labelColumns,omitempty"`
+}
+
+type AnalyticResult struct {
+	// Time the query was run.
+	// +required
+	Time metav1.Time `json:"time"`
+
+	// WindowStart start of the query window, unset if the query has no window.
+	// +optional
+	WindowStart *metav1.Time `json:"windowStart,omitempty"`
+
+	// Rows result rows of the run.
+	// +optional
+	Rows []map[string]string `json:"rows,omitempty"`
+
+	// Error of the run, empty if the query succeeded.
+	// +optional
+	Error string `json:"error,omitempty"`
 }
 
 // AnalyticStatus defines the observed state of Analytic
 type AnalyticStatus struct {
+	// ObservedGeneration is the last observed generation of the Analytic
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastRunTime is the last time the query was run.
+	// +optional
+	LastRunTime *metav1.Time `json:"lastRunTime,omitempty"`
+
+	// NextRunTime is the next time the query is scheduled to run.
+	// +optional
+	NextRunTime *metav1.Time `json:"nextRunTime,omitempty"`
+
+	// Rows result rows of the last successful run, the rows beyond 256KiB
+	// are left out.
+	// +optional
+	Rows []map[string]string `json:"rows,omitempty"`
+
+	// Error of the last run, empty if the query succeeded.
+	// +optional
+	Error string `json:"error,omitempty"`
+
+	// History results of the latest runs, newest first.
+	// +optional
+	History []AnalyticResult `json:"history,omitempty"`
+
+	// Conditions holds the conditions for the Analytic.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Status",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+//+kubebuilder:printcolumn:name="Last Run",type="date",JSONPath=".status.lastRunTime"
+//+kubebuilder:printcolumn:name="Next Run",type="date",JSONPath=".status.nextRunTime",priority=1
 
 // Analytic is the Schema for the analytics API
 type Analytic struct {
@@ -43,6 +177,85 @@ type Analytic struct {
 	Status AnalyticStatus `json:"status,omitempty"`
 }
 
+func (a *Analytic) MarkAsReady(message, reason string) {
+	cond := metav1.Condition{
+		Type:               AnalyticReadyCondition,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: a.Generation,
+		Message:            message,
+		Reason:             reason,
+		LastTransitionTime: metav1.Now(),
+	}
+	apimeta.SetStatusCondition(&a.Status.Conditions, cond)
+}
+
+func (a *Analytic) MarkAsNotReady(message, reason string) {
+	cond := metav1.Condition{
+		Type:               AnalyticReadyCondition,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: a.Generation,
+		Message:            message,
+		Reason:             reason,
+		LastTransitionTime: metav1.Now(),
+	}
+	apimeta.SetStatusCondition(&a.Status.Conditions, cond)
+}
+
+// MaxHistorySize maximum size in bytes of the encoded status history, so
+// that large results don't push the Analytic past the size limit of the
+// objects.
+const MaxHistorySize = 256 * 1024
+
+// AddResult records the result of a run at the head of the history,
+// dropping the oldest results beyond the history limit or the history
+// size. The rows of a result too large on its own are left out of the
+// history.
+func (a *Analytic) AddResult(result AnalyticResult) {
+	history := append([]AnalyticResult{result}, a.Status.History...)
+	if len(history) > a.Spec.HistoryLimit {
+		history = history[:a.Spec.HistoryLimit]
+	}
+
+	size := 0
+	for i := range history {
+		if i == 0 && encodedSize(history[0]) > MaxHistorySize {
+			history[0].Rows = nil
+		}
+		size += encodedSize(history[i])
+		if size > MaxHistorySize {
+			history = history[:i]
+			break
+		}
+	}
+	a.Status.History = history
+}
+
+// MaxRowsSize maximum size in bytes of the encoded rows of the last
+// successful run kept in the status.
+const MaxRowsSize = 256 * 1024
+
+// SetRows records the rows of the last successful run, dropping the rows
+// beyond MaxRowsSize.
+func (a *Analytic) SetRows(rows []map[string]string) {
+	size := 0
+	for i, row := range rows {
+		size += encodedSize(row)
+		if size > MaxRowsSize {
+			rows = rows[:i]
+			break
+		}
+	}
+	a.Status.Rows = rows
+}
+
+func encodedSize(value interface{}) int {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
 //+kubebuilder:object:root=true
 
 // AnalyticList contains a list of Analytic
@@ -0,0 +1,39 @@
+package v1alpha1
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAddResultCapsHistorySize(t *testing.T) {
+	analytic := Analytic{Spec: AnalyticSpec{HistoryLimit: 10}}
+	row := map[string]string{"message": strings.Repeat("x", MaxHistorySize/4)}
+
+	for i := 0; i < 10; i++ {
+		analytic.AddResult(AnalyticResult{Rows: []map[string]string{row}})
+	}
+	if got := len(analytic.Status.History); got != 3 {
+		t.Errorf("expected the history to be capped to 3 results, got %d", got)
+	}
+
+	large := AnalyticResult{Rows: []map[string]string{{"message": strings.Repeat("x", MaxHistorySize)}}}
+	analytic.AddResult(large)
+	if got := len(analytic.Status.History); got != 4 || analytic.Status.History[0].Rows != nil {
+		t.Errorf("expected the newest result to be kept without its rows, got %d results", got)
+	}
+}
+
+func TestSetRowsCapsRowsSize(t *testing.T) {
+	var analytic Analytic
+	row := map[string]string{"message": strings.Repeat("x", MaxRowsSize/4)}
+
+	analytic.SetRows([]map[string]string{row, row, row, row, row})
+	if got := len(analytic.Status.Rows); got != 3 {
+		t.Errorf("expected the rows to be capped to 3, got %d", got)
+	}
+
+	analytic.SetRows([]map[string]string{{"count": "1"}})
+	if got := len(analytic.Status.Rows); got != 1 {
+		t.Errorf("expected the small rows to be kept, got %d", got)
+	}
+}
@@ -17,12 +17,64 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"github.com/ahsayde/analytics-controller/pkg/events"
 	v1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	EventSetReadyCondition            = "Ready"
+	EventSetSinkRefsResolvedCondition = "SinkRefsResolved"
+)
+
+const (
+	// DeliveryAnnotation is set on the events written to the sinks with the
+	// update policy they are delivered under.
+	DeliveryAnnotation = "analytics.weave.works/delivery"
+	// CountDeltaAnnotation is set on the events delivered under the
+	// CountDelta update policy with the count increase since the previous
+	// delivery of the event.
+	CountDeltaAnnotation = "analytics.weave.works/count-delta"
+)
+
+const (
+	// FirstOccurrenceUpdatePolicy delivers an event once, when it is created.
+	FirstOccurrenceUpdatePolicy = "FirstOccurrence"
+	// EveryOccurrenceUpdatePolicy delivers an event when it is created and
+	// every time its count is bumped.
+	EveryOccurrenceUpdatePolicy = "EveryOccurrence"
+	// CountDeltaUpdatePolicy delivers an event like EveryOccurrence, with
+	// the count increase since the previous delivery in the
+	// CountDeltaAnnotation.
+	CountDeltaUpdatePolicy = "CountDelta"
+	// SummaryUpdatePolicy delivers an event once with its final count, when
+	// it is deleted from the cluster.
+	SummaryUpdatePolicy = "Summary"
+)
+
+const (
+	// SkipStartupPolicy skips the events that last occurred before the
+	// controller started.
+	SkipStartupPolicy = "Skip"
+	// ReplayAllStartupPolicy delivers all the events found in the cluster
+	// when the controller starts.
+	ReplayAllStartupPolicy = "ReplayAll"
+	// SinceCheckpointStartupPolicy resumes delivering to each sink after the
+	// latest event written to it by the previous controller run, or
+	// delivers all the events if there is no checkpoint.
+	SinceCheckpointStartupPolicy = "SinceCheckpoint"
 )
 
 //+kubebuilder:validation:MinProperties=1
 
+// EventResource selects the involved or related objects of the events. Name
+// and Namespace are patterns: globs where * matches any sequence of
+// characters and ? any single character, or regular expressions wrapped in
+// slashes such as /^my-app-[0-9]+$/.
 type EventResource struct {
 	// API version of the involved object.
 	// +optional
@@ -32,11 +84,11 @@ type EventResource struct {
 	// +optional
 	Kind string `json:"kind,omitempty"`
 
-	// Name of the involved object.
+	// Name pattern of the involved object.
 	// +optional
 	Name string `json:"name"`
 
-	// Namespace of the involved object.
+	// Namespace pattern of the involved object.
 	// +optional
 	Namespace string `json:"namespace,omitempty"`
 }
@@ -47,25 +99,86 @@ type EventFilter struct {
 	// +optional
 	Type string `json:"type,omitempty"`
 
-	// Reasons list of event reasons to watch.
+	// Reasons list of event reason patterns to watch, globs or regular
+	// expressions wrapped in slashes.
 	// +optional
 	Reasons []string `json:"reasons,omitempty"`
 
 	// Resources list of event's involved objects to watch.
 	// +optional
 	Resources []EventResource `json:"resources,omitempty"`
+
+	// SourceComponents list of source component patterns to watch, such as
+	// default-scheduler or kubelet.
+	// +optional
+	SourceComponents []string `json:"sourceComponents,omitempty"`
+
+	// SourceHosts list of source host patterns to watch.
+	// +optional
+	SourceHosts []string `json:"sourceHosts,omitempty"`
+
+	// ReportingControllers list of reporting controller patterns to watch,
+	// such as kustomize-controller.
+	// +optional
+	ReportingControllers []string `json:"reportingControllers,omitempty"`
+
+	// ReportingInstances list of reporting instance patterns to watch.
+	// +optional
+	ReportingInstances []string `json:"reportingInstances,omitempty"`
+
+	// Actions list of action patterns to watch.
+	// +optional
+	Actions []string `json:"actions,omitempty"`
+
+	// Related list of event's related objects to watch.
+	// +optional
+	Related []EventResource `json:"related,omitempty"`
+
+	// MessageRegex regular expression the event message must match.
+	// +optional
+	MessageRegex string `json:"messageRegex,omitempty"`
+
+	// NamespaceSelector selects the events whose involved object is in a
+	// namespace matching the selector. Cluster scoped objects only match
+	// an empty selector.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// ObjectSelector selects the events whose involved object has labels
+	// matching the selector. Only the objects of the kinds set with the
+	// controller's --label-selector-kinds flag, pods by default, can match.
+	// +optional
+	ObjectSelector *metav1.LabelSelector `json:"objectSelector,omitempty"`
+}
+
+// LabelLookup resolves the labels matched by the selectors of the filters.
+// +kubebuilder:object:generate=false
+type LabelLookup interface {
+	// ObjectLabels returns the labels of the involved object of an event,
+	// nil if it is not found.
+	ObjectLabels(ref v1.ObjectReference) labels.Set
+	// NamespaceLabels returns the labels of a namespace, nil if it is not
+	// found.
+	NamespaceLabels(namespace string) labels.Set
 }
 
-func (f *EventFilter) Match(event *v1.Event) bool {
+// Match reports whether the event matches all the fields of the filter,
+// with the patterns compiled by EventSetSpec.CompilePatterns. The selectors
+// are matched last, with the labels resolved by the lookup, and never match
+// if it is nil.
+func (f *EventFilter) Match(event *events.Event, lookup LabelLookup, compiled *Patterns) bool {
 	if f.Type != "" {
 		if f.Type != event.Type {
 			return false
 		}
 	}
-	if f.Reasons != nil {
+	if !matchAny(compiled, f.Reasons, event.Reason) {
+		return false
+	}
+	if f.Resources != nil {
 		var matched bool
-		for _, reason := range f.Reasons {
-			if reason == event.Reason {
+		for _, resource := range f.Resources {
+			if resource.match(&event.InvolvedObject, compiled) {
 				matched = true
 				break
 			}
@@ -74,31 +187,28 @@ func (f *EventFilter) Match(event *v1.Event) bool {
 			return false
 		}
 	}
-	if f.Resources != nil {
+	if !matchAny(compiled, f.SourceComponents, event.Source.Component) {
+		return false
+	}
+	if !matchAny(compiled, f.SourceHosts, event.Source.Host) {
+		return false
+	}
+	if !matchAny(compiled, f.ReportingControllers, event.ReportingController) {
+		return false
+	}
+	if !matchAny(compiled, f.ReportingInstances, event.ReportingInstance) {
+		return false
+	}
+	if !matchAny(compiled, f.Actions, event.Action) {
+		return false
+	}
+	if f.Related != nil {
+		if event.Related == nil {
+			return false
+		}
 		var matched bool
-		for _, resource := range f.Resources {
-			m := true
-			if resource.APIVersion != "" {
-				if resource.APIVersion != event.InvolvedObject.APIVersion {
-					m = false
-				}
-			}
-			if resource.Kind != "" {
-				if resource.Kind != event.InvolvedObject.Kind {
-					m = false
-				}
-			}
-			if resource.Name != "" {
-				if resource.Name != event.InvolvedObject.Name {
-					m = false
-				}
-			}
-			if resource.Namespace != "" {
-				if resource.Namespace != event.InvolvedObject.Namespace {
-					m = false
-				}
-			}
-			if m {
+		for _, related := range f.Related {
+			if related.match(event.Related, compiled) {
 				matched = true
 				break
 			}
@@ -107,24 +217,257 @@ func (f *EventFilter) Match(event *v1.Event) bool {
 			return false
 		}
 	}
+	if f.MessageRegex != "" {
+		if !compiled.match(messagePattern(f.MessageRegex), event.Message) {
+			return false
+		}
+	}
+	if f.NamespaceSelector != nil {
+		matched := matchSelector(f.NamespaceSelector, lookup, func() labels.Set {
+			if event.InvolvedObject.Namespace == "" {
+				return labels.Set{}
+			}
+			return lookup.NamespaceLabels(event.InvolvedObject.Namespace)
+		})
+		if !matched {
+			return false
+		}
+	}
+	if f.ObjectSelector != nil {
+		matched := matchSelector(f.ObjectSelector, lookup, func() labels.Set {
+			return lookup.ObjectLabels(event.InvolvedObject)
+		})
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny reports whether the value matches any of the patterns, all the
+// values match a nil list.
+func matchAny(compiled *Patterns, patterns []string, value string) bool {
+	if patterns == nil {
+		return true
+	}
+	for _, pattern := range patterns {
+		if compiled.match(pattern, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *EventResource) match(ref *v1.ObjectReference, compiled *Patterns) bool {
+	if r.APIVersion != "" {
+		if r.APIVersion != ref.APIVersion {
+			return false
+		}
+	}
+	if r.Kind != "" {
+		if r.Kind != ref.Kind {
+			return false
+		}
+	}
+	if r.Name != "" {
+		if !compiled.match(r.Name, ref.Name) {
+			return false
+		}
+	}
+	if r.Namespace != "" {
+		if !compiled.match(r.Namespace, ref.Namespace) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchSelector reports whether the labels returned by getLabels match the
+// selector, they are only looked up if the selector isn't empty.
+func matchSelector(labelSelector *metav1.LabelSelector, lookup LabelLookup, getLabels func() labels.Set) bool {
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return false
+	}
+	if selector.Empty() {
+		return true
+	}
+	if lookup == nil {
+		return false
+	}
+	return selector.Matches(getLabels())
+}
+
+// Validate returns the invalid patterns of the filter.
+func (f *EventFilter) Validate(path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	errs = append(errs, validatePatterns(f.Reasons, path.Child("reasons"))...)
+	errs = append(errs, validateResources(f.Resources, path.Child("resources"))...)
+	errs = append(errs, validatePatterns(f.SourceComponents, path.Child("sourceComponents"))...)
+	errs = append(errs, validatePatterns(f.SourceHosts, path.Child("sourceHosts"))...)
+	errs = append(errs, validatePatterns(f.ReportingControllers, path.Child("reportingControllers"))...)
+	errs = append(errs, validatePatterns(f.ReportingInstances, path.Child("reportingInstances"))...)
+	errs = append(errs, validatePatterns(f.Actions, path.Child("actions"))...)
+	errs = append(errs, validateResources(f.Related, path.Child("related"))...)
+	if f.MessageRegex != "" {
+		if err := validatePattern(messagePattern(f.MessageRegex)); err != nil {
+			errs = append(errs, field.Invalid(path.Child("messageRegex"), f.MessageRegex, err.Error()))
+		}
+	}
+	errs = append(errs, metav1validation.ValidateLabelSelector(f.NamespaceSelector, path.Child("namespaceSelector"))...)
+	errs = append(errs, metav1validation.ValidateLabelSelector(f.ObjectSelector, path.Child("objectSelector"))...)
+	return errs
+}
+
+// patterns returns the patterns of the filter.
+func (f *EventFilter) patterns() []string {
+	var patterns []string
+	patterns = append(patterns, f.Reasons...)
+	patterns = append(patterns, f.SourceComponents...)
+	patterns = append(patterns, f.SourceHosts...)
+	patterns = append(patterns, f.ReportingControllers...)
+	patterns = append(patterns, f.ReportingInstances...)
+	patterns = append(patterns, f.Actions...)
+	for _, resource := range f.Resources {
+		patterns = append(patterns, resource.Name, resource.Namespace)
+	}
+	for _, related := range f.Related {
+		patterns = append(patterns, related.Name, related.Namespace)
+	}
+	if f.MessageRegex != "" {
+		patterns = append(patterns, messagePattern(f.MessageRegex))
+	}
+	return patterns
+}
+
+func validatePatterns(patterns []string, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, pattern := range patterns {
+		if err := validatePattern(pattern); err != nil {
+			errs = append(errs, field.Invalid(path.Index(i), pattern, err.Error()))
+		}
+	}
+	return errs
+}
+
+func validateResources(resources []EventResource, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	for i, resource := range resources {
+		if err := validatePattern(resource.Name); err != nil {
+			errs = append(errs, field.Invalid(path.Index(i).Child("name"), resource.Name, err.Error()))
+		}
+		if err := validatePattern(resource.Namespace); err != nil {
+			errs = append(errs, field.Invalid(path.Index(i).Child("namespace"), resource.Namespace, err.Error()))
+		}
+	}
+	return errs
+}
+
+// Matches reports whether the event is delivered by the event set, that is
+// whether it is in one of its namespaces, matches the match filter and none
+// of the exclude filters.
+func (s *EventSetSpec) Matches(event *events.Event, lookup LabelLookup, compiled *Patterns) bool {
+	if !s.InNamespace(event.Namespace) {
+		return false
+	}
+	if !s.Match.Match(event, lookup, compiled) {
+		return false
+	}
+	for i := range s.Exclude {
+		if s.Exclude[i].Match(event, lookup, compiled) {
+			return false
+		}
+	}
 	return true
 }
 
+// InNamespace reports whether the event set is scoped to the namespace.
+func (s *EventSetSpec) InNamespace(namespace string) bool {
+	if len(s.Namespaces) == 0 {
+		return true
+	}
+	for _, ns := range s.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// messagePattern returns the pattern of the message regular expression.
+func messagePattern(expr string) string {
+	return "/" + expr + "/"
+}
+
 // EventSetSpec defines the desired state of EventSet
 type EventSetSpec struct {
+	// Match filter the events must match to be delivered.
 	//+required
 	Match EventFilter `json:"match"`
+
+	// Exclude list of filters evaluated after match, the events matching
+	// any of them are not delivered even though they match. Each filter
+	// excludes the events matching all of its fields.
+	// +optional
+	Exclude []EventFilter `json:"exclude,omitempty"`
+
+	// Expression CEL expression the events must match, evaluated against
+	// the event after match and exclude. For example
+	// `event.count > 5 && event.source.component == "kubelet"`.
+	// +optional
+	Expression string `json:"expression,omitempty"`
+
 	//+required
 	SinkRefs []v1.LocalObjectReference `json:"sinkRefs,omitempty"`
+
+	// UpdatePolicy defines how recurring events, which the api server
+	// reports by bumping the count of the same event, are delivered.
+	// +kubebuilder:validation:Enum=FirstOccurrence;EveryOccurrence;CountDelta;Summary
+	// +kubebuilder:default:=FirstOccurrence
+	// +optional
+	UpdatePolicy string `json:"updatePolicy,omitempty"`
+
+	// StartupPolicy defines which of the events found in the cluster when
+	// the controller starts are delivered, defaults to the controller's
+	// --startup-policy flag.
+	// +kubebuilder:validation:Enum=Skip;ReplayAll;SinceCheckpoint
+	// +optional
+	StartupPolicy string `json:"startupPolicy,omitempty"`
+
+	// Namespaces list of namespaces the event set is scoped to, the events
+	// of the other namespaces are ignored. Defaults to all the namespaces
+	// watched by the controller.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
 }
 
 // EventSetStatus defines the observed state of EventSet
 type EventSetStatus struct {
+	// ObservedGeneration is the last observed generation of the EventSet
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// MatchedEvents number of events matched since the controller started.
+	// +optional
+	MatchedEvents int64 `json:"matchedEvents,omitempty"`
+
+	// LastMatchTime is the last time an event was matched.
+	// +optional
+	LastMatchTime *metav1.Time `json:"lastMatchTime,omitempty"`
+
+	// Conditions holds the conditions for the EventSet.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Resolved",type="string",JSONPath=`.status.conditions[?(@.type=="SinkRefsResolved")].status`
+//+kubebuilder:printcolumn:name="Matched",type="integer",JSONPath=".status.matchedEvents"
+//+kubebuilder:printcolumn:name="Last Match",type="date",JSONPath=".status.lastMatchTime"
 
 // EventSet is the Schema for the eventsets API
 type EventSet struct {
@@ -135,6 +478,54 @@ type EventSet struct {
 	Status EventSetStatus `json:"status,omitempty"`
 }
 
+func (e *EventSet) MarkAsReady(message, reason string) {
+	cond := metav1.Condition{
+		Type:               EventSetReadyCondition,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: e.Generation,
+		Message:            message,
+		Reason:             reason,
+		LastTransitionTime: metav1.Now(),
+	}
+	apimeta.SetStatusCondition(&e.Status.Conditions, cond)
+}
+
+func (e *EventSet) MarkAsNotReady(message, reason string) {
+	cond := metav1.Condition{
+		Type:               EventSetReadyCondition,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: e.Generation,
+		Message:            message,
+		Reason:             reason,
+		LastTransitionTime: metav1.Now(),
+	}
+	apimeta.SetStatusCondition(&e.Status.Conditions, cond)
+}
+
+func (e *EventSet) MarkAsSinkRefsResolved(message, reason string) {
+	cond := metav1.Condition{
+		Type:               EventSetSinkRefsResolvedCondition,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: e.Generation,
+		Message:            message,
+		Reason:             reason,
+		LastTransitionTime: metav1.Now(),
+	}
+	apimeta.SetStatusCondition(&e.Status.Conditions, cond)
+}
+
+func (e *EventSet) MarkAsSinkRefsNotResolved(message, reason string) {
+	cond := metav1.Condition{
+		Type:               EventSetSinkRefsResolvedCondition,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: e.Generation,
+		Message:            message,
+		Reason:             reason,
+		LastTransitionTime: metav1.Now(),
+	}
+	apimeta.SetStatusCondition(&e.Status.Conditions, cond)
+}
+
 //+kubebuilder:object:root=true
 //+kubebuilder:resource:scope=Cluster
 
@@ -0,0 +1,397 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	"github.com/ahsayde/analytics-controller/pkg/events"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+func TestEventFilterMatchPatterns(t *testing.T) {
+	event := &events.Event{
+		Reason:  "BackOff",
+		Message: "Back-off restarting failed container app in pod my-app-7d9f",
+		InvolvedObject: v1.ObjectReference{
+			Kind:      "Pod",
+			Name:      "my-app-7d9f",
+			Namespace: "team-a",
+		},
+	}
+
+	tests := []struct {
+		name   string
+		filter EventFilter
+		want   bool
+	}{
+		{
+			name:   "exact reason",
+			filter: EventFilter{Reasons: []string{"BackOff"}},
+			want:   true,
+		},
+		{
+			name:   "reason glob",
+			filter: EventFilter{Reasons: []string{"Back*"}},
+			want:   true,
+		},
+		{
+			name:   "reason regex",
+			filter: EventFilter{Reasons: []string{"/^(Failed|BackOff)$/"}},
+			want:   true,
+		},
+		{
+			name:   "reason regex not matching",
+			filter: EventFilter{Reasons: []string{"/^Failed/"}},
+			want:   false,
+		},
+		{
+			name:   "name glob",
+			filter: EventFilter{Resources: []EventResource{{Kind: "Pod", Name: "my-app-*"}}},
+			want:   true,
+		},
+		{
+			name:   "name glob not matching",
+			filter: EventFilter{Resources: []EventResource{{Name: "other-*"}}},
+			want:   false,
+		},
+		{
+			name:   "namespace glob",
+			filter: EventFilter{Resources: []EventResource{{Namespace: "team-?"}}},
+			want:   true,
+		},
+		{
+			name:   "glob is anchored",
+			filter: EventFilter{Resources: []EventResource{{Namespace: "team"}}},
+			want:   false,
+		},
+		{
+			name:   "message regex",
+			filter: EventFilter{MessageRegex: "restarting failed container"},
+			want:   true,
+		},
+		{
+			name:   "message regex not matching",
+			filter: EventFilter{MessageRegex: "^Started"},
+			want:   false,
+		},
+		{
+			name:   "invalid pattern",
+			filter: EventFilter{Reasons: []string{"/(/"}},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(event, nil, nil); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEventFilterValidate(t *testing.T) {
+	filter := EventFilter{
+		Reasons:      []string{"Back*", "/(/"},
+		Resources:    []EventResource{{Name: "/[a-/", Namespace: "team-*"}},
+		MessageRegex: "(",
+	}
+
+	errs := filter.Validate(field.NewPath("spec", "match"))
+	want := []string{"spec.match.reasons[1]", "spec.match.resources[0].name", "spec.match.messageRegex"}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d errors, got %v", len(want), errs)
+	}
+	for i, err := range errs {
+		if err.Field != want[i] {
+			t.Errorf("expected an error on %s, got %s", want[i], err.Field)
+		}
+	}
+}
+
+func TestEventSetSpecMatchesExclusions(t *testing.T) {
+	newEvent := func(eventType, reason, namespace string) *events.Event {
+		return &events.Event{
+			Type:   eventType,
+			Reason: reason,
+			InvolvedObject: v1.ObjectReference{
+				Kind:      "Pod",
+				Name:      "app",
+				Namespace: namespace,
+			},
+		}
+	}
+
+	// all Warning events except FailedScheduling in kube-system
+	spec := EventSetSpec{
+		Match: EventFilter{Type: "Warning"},
+		Exclude: []EventFilter{
+			{
+				Reasons:   []string{"FailedScheduling"},
+				Resources: []EventResource{{Namespace: "kube-system"}},
+			},
+			{
+				MessageRegex: "^ignored",
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		event *events.Event
+		want  bool
+	}{
+		{
+			name:  "matched and not excluded",
+			event: newEvent("Warning", "BackOff", "kube-system"),
+			want:  true,
+		},
+		{
+			name:  "not matched",
+			event: newEvent("Normal", "Scheduled", "default"),
+			want:  false,
+		},
+		{
+			name:  "excluded by all the fields of a filter",
+			event: newEvent("Warning", "FailedScheduling", "kube-system"),
+			want:  false,
+		},
+		{
+			name:  "not excluded when only some fields of a filter match",
+			event: newEvent("Warning", "FailedScheduling", "default"),
+			want:  true,
+		},
+		{
+			name: "excluded by any filter",
+			event: func() *events.Event {
+				event := newEvent("Warning", "BackOff", "default")
+				event.Message = "ignored back-off"
+				return event
+			}(),
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := spec.Matches(tt.event, nil, spec.CompilePatterns()); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEventSetValidateRejectsEmptyExclusion(t *testing.T) {
+	eventSet := EventSet{
+		Spec: EventSetSpec{
+			Exclude: []EventFilter{{Type: "Normal"}, {}},
+		},
+	}
+
+	errs := eventSet.Validate()
+	if len(errs) != 1 || errs[0].Field != "spec.exclude[1]" {
+		t.Fatalf("expected an error on spec.exclude[1], got %v", errs)
+	}
+}
+
+func TestNamespacedEventSetValidateRejectsOtherNamespaces(t *testing.T) {
+	eventSet := NamespacedEventSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "events", Namespace: "team-a"},
+		Spec: EventSetSpec{
+			Namespaces: []string{"team-a", "team-b"},
+		},
+	}
+
+	errs := eventSet.Validate()
+	if len(errs) != 1 || errs[0].Field != "spec.namespaces[1]" {
+		t.Fatalf("expected an error on spec.namespaces[1], got %v", errs)
+	}
+}
+
+type fakeLookup struct {
+	objects    map[string]labels.Set
+	namespaces map[string]labels.Set
+}
+
+func (l fakeLookup) ObjectLabels(ref v1.ObjectReference) labels.Set {
+	return l.objects[ref.Name]
+}
+
+func (l fakeLookup) NamespaceLabels(namespace string) labels.Set {
+	return l.namespaces[namespace]
+}
+
+func TestEventFilterMatchSelectors(t *testing.T) {
+	lookup := fakeLookup{
+		objects: map[string]labels.Set{
+			"checkout": {"team": "payments"},
+			"search":   {"team": "discovery"},
+		},
+		namespaces: map[string]labels.Set{
+			"prod": {"env": "prod"},
+		},
+	}
+	newEvent := func(name, namespace string) *events.Event {
+		return &events.Event{
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Name: name, Namespace: namespace},
+		}
+	}
+	payments := &metav1.LabelSelector{MatchLabels: map[string]string{"team": "payments"}}
+	prod := &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}
+
+	tests := []struct {
+		name   string
+		filter EventFilter
+		event  *events.Event
+		lookup LabelLookup
+		want   bool
+	}{
+		{
+			name:   "object selector",
+			filter: EventFilter{ObjectSelector: payments},
+			event:  newEvent("checkout", "prod"),
+			lookup: lookup,
+			want:   true,
+		},
+		{
+			name:   "object selector not matching",
+			filter: EventFilter{ObjectSelector: payments},
+			event:  newEvent("search", "prod"),
+			lookup: lookup,
+			want:   false,
+		},
+		{
+			name:   "object not found",
+			filter: EventFilter{ObjectSelector: payments},
+			event:  newEvent("deleted", "prod"),
+			lookup: lookup,
+			want:   false,
+		},
+		{
+			name:   "namespace selector",
+			filter: EventFilter{NamespaceSelector: prod, ObjectSelector: payments},
+			event:  newEvent("checkout", "prod"),
+			lookup: lookup,
+			want:   true,
+		},
+		{
+			name:   "namespace selector not matching",
+			filter: EventFilter{NamespaceSelector: prod},
+			event:  newEvent("checkout", "dev"),
+			lookup: lookup,
+			want:   false,
+		},
+		{
+			name:   "cluster scoped object",
+			filter: EventFilter{NamespaceSelector: &metav1.LabelSelector{}},
+			event:  newEvent("node", ""),
+			lookup: lookup,
+			want:   true,
+		},
+		{
+			name:   "no lookup",
+			filter: EventFilter{ObjectSelector: payments},
+			event:  newEvent("checkout", "prod"),
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.event, tt.lookup, nil); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEventFilterMatchSourceFields(t *testing.T) {
+	event := &events.Event{
+		Source:              v1.EventSource{Component: "default-scheduler", Host: "node-1"},
+		ReportingController: "kustomize-controller",
+		ReportingInstance:   "kustomize-controller-6b8c",
+		Action:              "Reconcile",
+		Related: &v1.ObjectReference{
+			Kind:      "GitRepository",
+			Name:      "flux-system",
+			Namespace: "flux-system",
+		},
+	}
+
+	tests := []struct {
+		name   string
+		filter EventFilter
+		want   bool
+	}{
+		{
+			name:   "source component",
+			filter: EventFilter{SourceComponents: []string{"kubelet", "default-scheduler"}},
+			want:   true,
+		},
+		{
+			name:   "source component not matching",
+			filter: EventFilter{SourceComponents: []string{"kubelet"}},
+			want:   false,
+		},
+		{
+			name:   "source host",
+			filter: EventFilter{SourceHosts: []string{"node-*"}},
+			want:   true,
+		},
+		{
+			name:   "reporting controller and instance",
+			filter: EventFilter{ReportingControllers: []string{"kustomize-controller"}, ReportingInstances: []string{"kustomize-controller-*"}},
+			want:   true,
+		},
+		{
+			name:   "action",
+			filter: EventFilter{Actions: []string{"Apply"}},
+			want:   false,
+		},
+		{
+			name:   "related",
+			filter: EventFilter{Related: []EventResource{{Kind: "GitRepository", Namespace: "flux-*"}}},
+			want:   true,
+		},
+		{
+			name:   "related not matching",
+			filter: EventFilter{Related: []EventResource{{Kind: "Bucket"}}},
+			want:   false,
+		},
+		{
+			name:   "empty list matches nothing",
+			filter: EventFilter{Actions: []string{}},
+			want:   false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(event, nil, nil); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	if (&EventFilter{Related: []EventResource{{Kind: "GitRepository"}}}).Match(&events.Event{}, nil, nil) {
+		t.Error("expected events without related object not to match")
+	}
+}
+
+func TestEventSetSpecMatchesNamespaces(t *testing.T) {
+	spec := EventSetSpec{Namespaces: []string{"team-a", "team-b"}}
+
+	for namespace, want := range map[string]bool{"team-a": true, "team-b": true, "team-c": false, "": false} {
+		event := &events.Event{}
+		event.Namespace = namespace
+		if got := spec.Matches(event, nil, nil); got != want {
+			t.Errorf("expected %v for namespace %q, got %v", want, namespace, got)
+		}
+	}
+
+	if !(&EventSetSpec{}).Matches(&events.Event{}, nil, nil) {
+		t.Error("expected event sets without namespaces to match all namespaces")
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+func (e *EventSet) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(e).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-analytics-weave-works-v1alpha1-eventset,mutating=false,failurePolicy=fail,sideEffects=None,groups=analytics.weave.works,resources=eventsets,verbs=create;update,versions=v1alpha1,name=veventset.analytics.weave.works,admissionReviewVersions=v1
+
+var _ webhook.Validator = &EventSet{}
+
+// Validate returns the invalid fields of the event set.
+func (e *EventSet) Validate() field.ErrorList {
+	return e.Spec.Validate(field.NewPath("spec"))
+}
+
+// Validate returns the invalid filters of the spec.
+func (s *EventSetSpec) Validate(path *field.Path) field.ErrorList {
+	errs := s.Match.Validate(path.Child("match"))
+	for i, exclude := range s.Exclude {
+		path := path.Child("exclude").Index(i)
+		// an empty filter matches, and so would exclude, all the events
+		if reflect.DeepEqual(exclude, EventFilter{}) {
+			errs = append(errs, field.Required(path, "exclude filters must set at least one field"))
+			continue
+		}
+		errs = append(errs, exclude.Validate(path)...)
+	}
+	return errs
+}
+
+func (e *EventSet) ValidateCreate() error {
+	return e.validate()
+}
+
+func (e *EventSet) ValidateUpdate(old runtime.Object) error {
+	return e.validate()
+}
+
+func (e *EventSet) ValidateDelete() error {
+	return nil
+}
+
+func (e *EventSet) validate() error {
+	errs := e.Validate()
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("EventSet").GroupKind(), e.Name, errs)
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Resolved",type="string",JSONPath=`.status.conditions[?(@.type=="SinkRefsResolved")].status`
+//+kubebuilder:printcolumn:name="Matched",type="integer",JSONPath=".status.matchedEvents"
+//+kubebuilder:printcolumn:name="Last Match",type="date",JSONPath=".status.lastMatchTime"
+
+// NamespacedEventSet is the Schema for the namespacedeventsets API, an
+// EventSet tenants manage in their own namespace. It only ever matches the
+// events of its namespace and its sinkRefs reference the NamespacedSinks
+// of its namespace.
+type NamespacedEventSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   EventSetSpec   `json:"spec,omitempty"`
+	Status EventSetStatus `json:"status,omitempty"`
+}
+
+// Validate returns the invalid fields of the event set, its namespaces can
+// only list its own namespace.
+func (e *NamespacedEventSet) Validate() field.ErrorList {
+	errs := e.Spec.Validate(field.NewPath("spec"))
+	for i, namespace := range e.Spec.Namespaces {
+		if namespace != e.Namespace {
+			path := field.NewPath("spec", "namespaces").Index(i)
+			errs = append(errs, field.Forbidden(path, "namespaced event sets only match the events of their namespace"))
+		}
+	}
+	return errs
+}
+
+//+kubebuilder:object:root=true
+
+// NamespacedEventSetList contains a list of NamespacedEventSet
+type NamespacedEventSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NamespacedEventSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NamespacedEventSet{}, &NamespacedEventSetList{})
+}
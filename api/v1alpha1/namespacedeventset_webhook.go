@@ -0,0 +1,54 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+func (e *NamespacedEventSet) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(e).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-analytics-weave-works-v1alpha1-namespacedeventset,mutating=false,failurePolicy=fail,sideEffects=None,groups=analytics.weave.works,resources=namespacedeventsets,verbs=create;update,versions=v1alpha1,name=vnamespacedeventset.analytics.weave.works,admissionReviewVersions=v1
+
+var _ webhook.Validator = &NamespacedEventSet{}
+
+func (e *NamespacedEventSet) ValidateCreate() error {
+	return e.validate()
+}
+
+func (e *NamespacedEventSet) ValidateUpdate(old runtime.Object) error {
+	return e.validate()
+}
+
+func (e *NamespacedEventSet) ValidateDelete() error {
+	return nil
+}
+
+func (e *NamespacedEventSet) validate() error {
+	errs := e.Validate()
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("NamespacedEventSet").GroupKind(), e.Name, errs)
+}
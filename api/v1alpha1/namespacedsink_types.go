@@ -0,0 +1,89 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Status",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+//+kubebuilder:printcolumn:name="Healthy",type="string",JSONPath=`.status.conditions[?(@.type=="Healthy")].status`
+//+kubebuilder:printcolumn:name="Dropped",type="integer",JSONPath=".status.droppedEvents",priority=1
+
+// NamespacedSink is the Schema for the namespacedsinks API, a Sink tenants
+// manage in their own namespace. It can only be referenced by the
+// NamespacedEventSets of its namespace and can't use anything outside of
+// it, see Validate.
+type NamespacedSink struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SinkSpec   `json:"spec,omitempty"`
+	Status SinkStatus `json:"status,omitempty"`
+}
+
+// Validate returns the fields of the sink a tenant isn't allowed to set:
+// the sinks, spools and dead-letter files written to the controller's
+// filesystem and the secrets of other namespaces.
+func (s *NamespacedSink) Validate() field.ErrorList {
+	var errs field.ErrorList
+	spec := field.NewPath("spec")
+
+	if s.Spec.File != nil {
+		errs = append(errs, field.Forbidden(spec.Child("file"), "file sinks are not supported by namespaced sinks"))
+	}
+	if s.Spec.SQLite != nil {
+		errs = append(errs, field.Forbidden(spec.Child("sqlite"), "sqlite sinks are not supported by namespaced sinks"))
+	}
+	if s.Spec.Spool != nil {
+		errs = append(errs, field.Forbidden(spec.Child("spool"), "spools are not supported by namespaced sinks"))
+	}
+	if queue := s.Spec.Queue; queue != nil {
+		if queue.OverflowPolicy == SpillToDiskOverflowPolicy {
+			errs = append(errs, field.NotSupported(spec.Child("queue", "overflowPolicy"), queue.OverflowPolicy,
+				[]string{BlockWithTimeoutOverflowPolicy, DropNewestOverflowPolicy, DropOldestOverflowPolicy}))
+		}
+		if queue.SpillPath != "" {
+			errs = append(errs, field.Forbidden(spec.Child("queue", "spillPath"), "spill paths are not supported by namespaced sinks"))
+		}
+	}
+	if deadLetter := s.Spec.DeadLetter; deadLetter != nil && deadLetter.Path != "" {
+		errs = append(errs, field.Forbidden(spec.Child("deadLetter", "path"), "dead-letter files are not supported by namespaced sinks"))
+	}
+	if ref := s.Spec.SecretRef; ref != nil && ref.Namespace != "" && ref.Namespace != s.Namespace {
+		errs = append(errs, field.Forbidden(spec.Child("secretRef", "namespace"), "the secret must be in the namespace of the sink"))
+	}
+	return errs
+}
+
+//+kubebuilder:object:root=true
+
+// NamespacedSinkList contains a list of NamespacedSink
+type NamespacedSinkList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []NamespacedSink `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&NamespacedSink{}, &NamespacedSinkList{})
+}
@@ -0,0 +1,69 @@
+package v1alpha1
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNamespacedSinkValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  SinkSpec
+		field string
+	}{
+		{
+			name: "webhook",
+			spec: SinkSpec{Webhook: &WebhookSink{Endpoint: "http://example.com"}},
+		},
+		{
+			name:  "file",
+			spec:  SinkSpec{File: &FileSink{Path: "/tmp/events.json"}},
+			field: "spec.file",
+		},
+		{
+			name: "spill to disk",
+			spec: SinkSpec{
+				Webhook: &WebhookSink{Endpoint: "http://example.com"},
+				Queue:   &SinkQueue{OverflowPolicy: SpillToDiskOverflowPolicy},
+			},
+			field: "spec.queue.overflowPolicy",
+		},
+		{
+			name: "dead-letter file",
+			spec: SinkSpec{
+				Webhook:    &WebhookSink{Endpoint: "http://example.com"},
+				DeadLetter: &SinkDeadLetter{Path: "/tmp/dead-letters.json"},
+			},
+			field: "spec.deadLetter.path",
+		},
+		{
+			name: "secret in another namespace",
+			spec: SinkSpec{
+				Webhook:   &WebhookSink{Endpoint: "http://example.com"},
+				SecretRef: &v1.SecretReference{Name: "creds", Namespace: "team-b"},
+			},
+			field: "spec.secretRef.namespace",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := NamespacedSink{
+				ObjectMeta: metav1.ObjectMeta{Name: "sink", Namespace: "team-a"},
+				Spec:       tt.spec,
+			}
+			errs := sink.Validate()
+			if tt.field == "" {
+				if len(errs) > 0 {
+					t.Fatalf("expected no error, got %v", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || errs[0].Field != tt.field {
+				t.Fatalf("expected an error on %s, got %v", tt.field, errs)
+			}
+		})
+	}
+}
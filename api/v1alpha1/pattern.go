@@ -0,0 +1,117 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Patterns holds the compiled regular expressions of the patterns of an
+// event set, so that they are compiled once rather than for every matched
+// event. A nil Patterns compiles the patterns as they are matched.
+// +kubebuilder:object:generate=false
+type Patterns struct {
+	compiled map[string]*regexp.Regexp
+}
+
+// CompilePatterns compiles the glob and regular expression patterns of the
+// filters of the spec, the invalid ones are left out and match nothing.
+func (s *EventSetSpec) CompilePatterns() *Patterns {
+	p := &Patterns{compiled: make(map[string]*regexp.Regexp)}
+	p.add(s.Match.patterns())
+	for i := range s.Exclude {
+		p.add(s.Exclude[i].patterns())
+	}
+	return p
+}
+
+func (p *Patterns) add(patterns []string) {
+	for _, pattern := range patterns {
+		if !isRegex(pattern) && !isGlob(pattern) {
+			continue
+		}
+		if _, ok := p.compiled[pattern]; ok {
+			continue
+		}
+		if re, err := compilePattern(pattern); err == nil {
+			p.compiled[pattern] = re
+		}
+	}
+}
+
+// match reports whether the value matches the pattern, plain strings match
+// by equality. Invalid patterns match nothing.
+func (p *Patterns) match(pattern, value string) bool {
+	if !isRegex(pattern) && !isGlob(pattern) {
+		return pattern == value
+	}
+	var re *regexp.Regexp
+	if p != nil {
+		re = p.compiled[pattern]
+	} else {
+		re, _ = compilePattern(pattern)
+	}
+	return re != nil && re.MatchString(value)
+}
+
+// isRegex reports whether the pattern is a regular expression, which are
+// wrapped in slashes.
+func isRegex(pattern string) bool {
+	return len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
+
+// isGlob reports whether the pattern has glob wildcards.
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?")
+}
+
+// compilePattern returns the regular expression of a pattern, either a
+// regular expression wrapped in slashes or a glob where * matches any
+// sequence of characters and ? any single character.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	var expr string
+	if isRegex(pattern) {
+		expr = pattern[1 : len(pattern)-1]
+	} else {
+		var b strings.Builder
+		b.WriteString("^")
+		for _, r := range pattern {
+			switch r {
+			case '*':
+				b.WriteString(".*")
+			case '?':
+				b.WriteString(".")
+			default:
+				b.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		b.WriteString("$")
+		expr = b.String()
+	}
+
+	return regexp.Compile(expr)
+}
+
+// validatePattern returns the error compiling the pattern, if any.
+func validatePattern(pattern string) error {
+	if !isRegex(pattern) && !isGlob(pattern) {
+		return nil
+	}
+	_, err := compilePattern(pattern)
+	return err
+}
@@ -23,7 +23,31 @@ import (
 )
 
 const (
-	SinkReadyCondition = "Ready"
+	SinkReadyCondition          = "Ready"
+	SinkDroppingEventsCondition = "DroppingEvents"
+	SinkHealthyCondition        = "Healthy"
+)
+
+const (
+	// FailedSinkAnnotation is set on the events written to a dead-letter
+	// sink with the name of the sink that failed to deliver them.
+	FailedSinkAnnotation = "analytics.weave.works/failed-sink"
+	// DeliveryErrorAnnotation is set on the events written to a dead-letter
+	// sink with the last delivery error.
+	DeliveryErrorAnnotation = "analytics.weave.works/delivery-error"
+)
+
+const (
+	// BlockWithTimeoutOverflowPolicy waits for room in the queue, the event
+	// is dropped if there is none before the timeout.
+	BlockWithTimeoutOverflowPolicy = "BlockWithTimeout"
+	// DropNewestOverflowPolicy drops the event written to the full queue.
+	DropNewestOverflowPolicy = "DropNewest"
+	// DropOldestOverflowPolicy drops the oldest queued event to make room.
+	DropOldestOverflowPolicy = "DropOldest"
+	// SpillToDiskOverflowPolicy spools the events overflowing the queue on
+	// disk until the queue has room again.
+	SpillToDiskOverflowPolicy = "SpillToDisk"
 )
 
 type FileSink struct {
@@ -46,6 +70,11 @@ type WebhookSink struct {
 	// Endpoint webhook url
 	// +required
 	Headers map[string]string `json:"headers"`
+
+	// Probe send a HEAD request to the endpoint when the sink is registered
+	// to check that it is reachable.
+	// +optional
+	Probe bool `json:"probe,omitempty"`
 }
 
 type ElasticSink struct {
@@ -80,6 +109,73 @@ type ElasticSink struct {
 	BatchExpiry int `json:"batchExpiry"`
 }
 
+type SinkSpool struct {
+	// Path directory to write the spool segments to, it should be on a
+	// persistent volume.
+	// +required
+	Path string `json:"path"`
+
+	// SegmentSize maximum size in bytes of a spool segment file.
+	// +kubebuilder:default:=8388608
+	// +kubebuilder:validation:Minimum=1024
+	// +optional
+	SegmentSize int64 `json:"segmentSize,omitempty"`
+}
+
+type SinkQueue struct {
+	// Size maximum number of events held in memory waiting to be delivered.
+	// +kubebuilder:default:=50
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Size int `json:"size,omitempty"`
+
+	// OverflowPolicy what happens to the events written while the queue is
+	// full, one of BlockWithTimeout, DropNewest, DropOldest or SpillToDisk.
+	// +kubebuilder:validation:Enum=BlockWithTimeout;DropNewest;DropOldest;SpillToDisk
+	// +kubebuilder:default:=BlockWithTimeout
+	// +optional
+	OverflowPolicy string `json:"overflowPolicy,omitempty"`
+
+	// BlockTimeout how long writes wait for room in the queue under the
+	// BlockWithTimeout policy.
+	// +kubebuilder:default:="1s"
+	// +optional
+	BlockTimeout *metav1.Duration `json:"blockTimeout,omitempty"`
+
+	// SpillPath directory to spool the events overflowing the queue to under
+	// the SpillToDisk policy.
+	// +optional
+	SpillPath string `json:"spillPath,omitempty"`
+}
+
+type SinkRetry struct {
+	// Retries number of times a failed write is retried.
+	// +kubebuilder:default:=5
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Retries int `json:"retries"`
+
+	// Interval wait before the first retry, doubled on every retry.
+	// +kubebuilder:default:="500ms"
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// MaxInterval maximum wait between retries.
+	// +kubebuilder:default:="30s"
+	// +optional
+	MaxInterval *metav1.Duration `json:"maxInterval,omitempty"`
+}
+
+type SinkDeadLetter struct {
+	// SinkRef sink to write the events exhausting their retries to.
+	// +optional
+	SinkRef *v1.LocalObjectReference `json:"sinkRef,omitempty"`
+
+	// Path file to append the events exhausting their retries to.
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
 func (os *ElasticSink) SetSecretConf(secretConf map[string]string) {
 	if username, ok := secretConf["username"]; ok {
 		os.Username = username
@@ -107,17 +203,68 @@ type SinkSpec struct {
 	// +optional
 	Elastic *ElasticSink `json:"elastic,omitempty"`
 
+	// Queue configures the in-memory queue of the events waiting to be
+	// delivered. Ignored by sqlite and when spool is set.
+	// +optional
+	Queue *SinkQueue `json:"queue,omitempty"`
+
+	// Spool persist the queued events on disk until they are delivered, so
+	// they are not lost on restarts and outages. Not supported by sqlite.
+	// +optional
+	Spool *SinkSpool `json:"spool,omitempty"`
+
+	// Retry configures the retries of failed writes. Ignored by sqlite.
+	// +optional
+	Retry *SinkRetry `json:"retry,omitempty"`
+
+	// DeadLetter where to write the events exhausting their retries, they
+	// are dropped if not set. Ignored by sqlite.
+	// +optional
+	DeadLetter *SinkDeadLetter `json:"deadLetter,omitempty"`
+
 	// SecretRef secret reference to get secret configs from.
 	// +optional
 	SecretRef *v1.SecretReference `json:"secretRef,omitempty"`
 }
 
+// SinkHealth is the delivery health of a sink.
+type SinkHealth struct {
+	// ConsecutiveFailures number of failed writes since the last successful
+	// one.
+	// +optional
+	ConsecutiveFailures int `json:"consecutiveFailures,omitempty"`
+
+	// LastSuccessTime time of the last successful write.
+	// +optional
+	LastSuccessTime *metav1.Time `json:"lastSuccessTime,omitempty"`
+
+	// LastFailureTime time of the last failed write.
+	// +optional
+	LastFailureTime *metav1.Time `json:"lastFailureTime,omitempty"`
+
+	// LastError error of the last failed write.
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+
+	// CircuitOpen whether writes are suspended after repeated failures.
+	// +optional
+	CircuitOpen bool `json:"circuitOpen,omitempty"`
+}
+
 // SinkStatus defines the observed state of Sink
 type SinkStatus struct {
 	// ObservedGeneration is the last observed generation of the Sink
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 
+	// Health delivery health of the sink, not tracked by sqlite.
+	// +optional
+	Health *SinkHealth `json:"health,omitempty"`
+
+	// DroppedEvents number of events dropped since the sink started.
+	// +optional
+	DroppedEvents int64 `json:"droppedEvents,omitempty"`
+
 	// Conditions holds the conditions for the Sink.
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
@@ -129,6 +276,8 @@ type SinkStatus struct {
 //+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 //+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].status`
 //+kubebuilder:printcolumn:name="Status",type="string",JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+//+kubebuilder:printcolumn:name="Healthy",type="string",JSONPath=`.status.conditions[?(@.type=="Healthy")].status`
+//+kubebuilder:printcolumn:name="Dropped",type="integer",JSONPath=".status.droppedEvents",priority=1
 
 // Sink is the Schema for the sinks API
 type Sink struct {
@@ -163,6 +312,54 @@ func (s *Sink) MarkAsNotReady(message, reason string) {
 	apimeta.SetStatusCondition(&s.Status.Conditions, cond)
 }
 
+func (s *Sink) MarkAsDroppingEvents(message, reason string) {
+	cond := metav1.Condition{
+		Type:               SinkDroppingEventsCondition,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: s.Generation,
+		Message:            message,
+		Reason:             reason,
+		LastTransitionTime: metav1.Now(),
+	}
+	apimeta.SetStatusCondition(&s.Status.Conditions, cond)
+}
+
+func (s *Sink) MarkAsNotDroppingEvents(message, reason string) {
+	cond := metav1.Condition{
+		Type:               SinkDroppingEventsCondition,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: s.Generation,
+		Message:            message,
+		Reason:             reason,
+		LastTransitionTime: metav1.Now(),
+	}
+	apimeta.SetStatusCondition(&s.Status.Conditions, cond)
+}
+
+func (s *Sink) MarkAsHealthy(message, reason string) {
+	cond := metav1.Condition{
+		Type:               SinkHealthyCondition,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: s.Generation,
+		Message:            message,
+		Reason:             reason,
+		LastTransitionTime: metav1.Now(),
+	}
+	apimeta.SetStatusCondition(&s.Status.Conditions, cond)
+}
+
+func (s *Sink) MarkAsDegraded(message, reason string) {
+	cond := metav1.Condition{
+		Type:               SinkHealthyCondition,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: s.Generation,
+		Message:            message,
+		Reason:             reason,
+		LastTransitionTime: metav1.Now(),
+	}
+	apimeta.SetStatusCondition(&s.Status.Conditions, cond)
+}
+
 //+kubebuilder:object:root=true
 //+kubebuilder:resource:scope=Cluster
 
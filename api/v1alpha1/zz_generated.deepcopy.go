@@ -22,9 +22,9 @@ limitations under the License.
 package v1alpha1
 
 import (
-	"k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	runtime "k8s.io/apimachinery/pkg/runtime"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -32,8 +32,8 @@ func (in *Analytic) DeepCopyInto(out *Analytic) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
-	out.Status = in.Status
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Analytic.
@@ -86,10 +86,93 @@ func (in *AnalyticList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AnalyticMetric) DeepCopyInto(out *AnalyticMetric) {
+	*out = *in
+	if in.LabelColumns != nil {
+		in, out := &in.LabelColumns, &out.LabelColumns
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnalyticMetric.
+func (in *AnalyticMetric) DeepCopy() *AnalyticMetric {
+	if in == nil {
+		return nil
+	}
+	out := new(AnalyticMetric)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AnalyticResult) DeepCopyInto(out *AnalyticResult) {
+	*out = *in
+	in.Time.DeepCopyInto(&out.Time)
+	if in.WindowStart != nil {
+		in, out := &in.WindowStart, &out.WindowStart
+		*out = (*in).DeepCopy()
+	}
+	if in.Rows != nil {
+		in, out := &in.Rows, &out.Rows
+		*out = make([]map[string]string, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = make(map[string]string, len(*in))
+				for key, val := range *in {
+					(*out)[key] = val
+				}
+			}
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnalyticResult.
+func (in *AnalyticResult) DeepCopy() *AnalyticResult {
+	if in == nil {
+		return nil
+	}
+	out := new(AnalyticResult)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AnalyticSinkReference) DeepCopyInto(out *AnalyticSinkReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnalyticSinkReference.
+func (in *AnalyticSinkReference) DeepCopy() *AnalyticSinkReference {
+	if in == nil {
+		return nil
+	}
+	out := new(AnalyticSinkReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AnalyticSpec) DeepCopyInto(out *AnalyticSpec) {
 	*out = *in
 	out.SinkRef = in.SinkRef
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Window != nil {
+		in, out := &in.Window, &out.Window
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.Metric != nil {
+		in, out := &in.Metric, &out.Metric
+		*out = new(AnalyticMetric)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnalyticSpec.
@@ -105,6 +188,41 @@ func (in *AnalyticSpec) DeepCopy() *AnalyticSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AnalyticStatus) DeepCopyInto(out *AnalyticStatus) {
 	*out = *in
+	if in.LastRunTime != nil {
+		in, out := &in.LastRunTime, &out.LastRunTime
+		*out = (*in).DeepCopy()
+	}
+	if in.NextRunTime != nil {
+		in, out := &in.NextRunTime, &out.NextRunTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Rows != nil {
+		in, out := &in.Rows, &out.Rows
+		*out = make([]map[string]string, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = make(map[string]string, len(*in))
+				for key, val := range *in {
+					(*out)[key] = val
+				}
+			}
+		}
+	}
+	if in.History != nil {
+		in, out := &in.History, &out.History
+		*out = make([]AnalyticResult, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnalyticStatus.
@@ -145,6 +263,46 @@ func (in *EventFilter) DeepCopyInto(out *EventFilter) {
 		*out = make([]EventResource, len(*in))
 		copy(*out, *in)
 	}
+	if in.SourceComponents != nil {
+		in, out := &in.SourceComponents, &out.SourceComponents
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SourceHosts != nil {
+		in, out := &in.SourceHosts, &out.SourceHosts
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ReportingControllers != nil {
+		in, out := &in.ReportingControllers, &out.ReportingControllers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ReportingInstances != nil {
+		in, out := &in.ReportingInstances, &out.ReportingInstances
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Actions != nil {
+		in, out := &in.Actions, &out.Actions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Related != nil {
+		in, out := &in.Related, &out.Related
+		*out = make([]EventResource, len(*in))
+		copy(*out, *in)
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ObjectSelector != nil {
+		in, out := &in.ObjectSelector, &out.ObjectSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EventFilter.
@@ -178,7 +336,7 @@ func (in *EventSet) DeepCopyInto(out *EventSet) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EventSet.
@@ -235,9 +393,21 @@ func (in *EventSetList) DeepCopyObject() runtime.Object {
 func (in *EventSetSpec) DeepCopyInto(out *EventSetSpec) {
 	*out = *in
 	in.Match.DeepCopyInto(&out.Match)
+	if in.Exclude != nil {
+		in, out := &in.Exclude, &out.Exclude
+		*out = make([]EventFilter, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	if in.SinkRefs != nil {
 		in, out := &in.SinkRefs, &out.SinkRefs
-		*out = make([]v1.LocalObjectReference, len(*in))
+		*out = make([]corev1.LocalObjectReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
 }
@@ -255,6 +425,17 @@ func (in *EventSetSpec) DeepCopy() *EventSetSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EventSetStatus) DeepCopyInto(out *EventSetStatus) {
 	*out = *in
+	if in.LastMatchTime != nil {
+		in, out := &in.LastMatchTime, &out.LastMatchTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EventSetStatus.
@@ -282,6 +463,124 @@ func (in *FileSink) DeepCopy() *FileSink {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespacedEventSet) DeepCopyInto(out *NamespacedEventSet) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespacedEventSet.
+func (in *NamespacedEventSet) DeepCopy() *NamespacedEventSet {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespacedEventSet)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NamespacedEventSet) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespacedEventSetList) DeepCopyInto(out *NamespacedEventSetList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NamespacedEventSet, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespacedEventSetList.
+func (in *NamespacedEventSetList) DeepCopy() *NamespacedEventSetList {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespacedEventSetList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NamespacedEventSetList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespacedSink) DeepCopyInto(out *NamespacedSink) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespacedSink.
+func (in *NamespacedSink) DeepCopy() *NamespacedSink {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespacedSink)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NamespacedSink) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespacedSinkList) DeepCopyInto(out *NamespacedSinkList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]NamespacedSink, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespacedSinkList.
+func (in *NamespacedSinkList) DeepCopy() *NamespacedSinkList {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespacedSinkList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *NamespacedSinkList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Sink) DeepCopyInto(out *Sink) {
 	*out = *in
@@ -309,6 +608,49 @@ func (in *Sink) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SinkDeadLetter) DeepCopyInto(out *SinkDeadLetter) {
+	*out = *in
+	if in.SinkRef != nil {
+		in, out := &in.SinkRef, &out.SinkRef
+		*out = new(corev1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SinkDeadLetter.
+func (in *SinkDeadLetter) DeepCopy() *SinkDeadLetter {
+	if in == nil {
+		return nil
+	}
+	out := new(SinkDeadLetter)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SinkHealth) DeepCopyInto(out *SinkHealth) {
+	*out = *in
+	if in.LastSuccessTime != nil {
+		in, out := &in.LastSuccessTime, &out.LastSuccessTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastFailureTime != nil {
+		in, out := &in.LastFailureTime, &out.LastFailureTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SinkHealth.
+func (in *SinkHealth) DeepCopy() *SinkHealth {
+	if in == nil {
+		return nil
+	}
+	out := new(SinkHealth)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SinkList) DeepCopyInto(out *SinkList) {
 	*out = *in
@@ -341,6 +683,51 @@ func (in *SinkList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SinkQueue) DeepCopyInto(out *SinkQueue) {
+	*out = *in
+	if in.BlockTimeout != nil {
+		in, out := &in.BlockTimeout, &out.BlockTimeout
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SinkQueue.
+func (in *SinkQueue) DeepCopy() *SinkQueue {
+	if in == nil {
+		return nil
+	}
+	out := new(SinkQueue)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SinkRetry) DeepCopyInto(out *SinkRetry) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MaxInterval != nil {
+		in, out := &in.MaxInterval, &out.MaxInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SinkRetry.
+func (in *SinkRetry) DeepCopy() *SinkRetry {
+	if in == nil {
+		return nil
+	}
+	out := new(SinkRetry)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SinkSpec) DeepCopyInto(out *SinkSpec) {
 	*out = *in
@@ -364,9 +751,29 @@ func (in *SinkSpec) DeepCopyInto(out *SinkSpec) {
 		*out = new(ElasticSink)
 		**out = **in
 	}
+	if in.Queue != nil {
+		in, out := &in.Queue, &out.Queue
+		*out = new(SinkQueue)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Spool != nil {
+		in, out := &in.Spool, &out.Spool
+		*out = new(SinkSpool)
+		**out = **in
+	}
+	if in.Retry != nil {
+		in, out := &in.Retry, &out.Retry
+		*out = new(SinkRetry)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DeadLetter != nil {
+		in, out := &in.DeadLetter, &out.DeadLetter
+		*out = new(SinkDeadLetter)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.SecretRef != nil {
 		in, out := &in.SecretRef, &out.SecretRef
-		*out = new(v1.SecretReference)
+		*out = new(corev1.SecretReference)
 		**out = **in
 	}
 }
@@ -381,12 +788,32 @@ func (in *SinkSpec) DeepCopy() *SinkSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SinkSpool) DeepCopyInto(out *SinkSpool) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SinkSpool.
+func (in *SinkSpool) DeepCopy() *SinkSpool {
+	if in == nil {
+		return nil
+	}
+	out := new(SinkSpool)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SinkStatus) DeepCopyInto(out *SinkStatus) {
 	*out = *in
+	if in.Health != nil {
+		in, out := &in.Health, &out.Health
+		*out = new(SinkHealth)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
-		*out = make([]metav1.Condition, len(*in))
+		*out = make([]v1.Condition, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
@@ -18,42 +18,298 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/ahsayde/analytics-controller/internal/metrics"
+	"github.com/ahsayde/analytics-controller/internal/sinks"
+	"github.com/ahsayde/analytics-controller/internal/watcher"
+	"github.com/robfig/cron/v3"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
-	analyticsweaveworksv1alpha1 "github.com/ahsayde/analytics-controller/api/v1alpha1"
+	v1alpha1 "github.com/ahsayde/analytics-controller/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	QuerySucceededReason      = "QuerySucceeded"
+	QueryFailedReason         = "QueryFailed"
+	SinkNotFoundReason        = "SinkNotFound"
+	SinkNotQueryableReason    = "SinkNotQueryable"
+	InvalidScheduleReason     = "InvalidSchedule"
+	InvalidMetricReason       = "InvalidMetric"
+	InvalidSinkRefReason      = "InvalidSinkRef"
+	SinkForbiddenReason       = "SinkForbidden"
+	AuthorizationFailedReason = "AuthorizationFailed"
+
+	// maxResultRows caps the number of rows kept in the status to keep
+	// the object well below the api server size limit.
+	maxResultRows = 100
+
+	sinkNotFoundRequeueInterval = 10 * time.Second
 )
 
 // AnalyticReconciler reconciles a Analytic object
 type AnalyticReconciler struct {
 	client.Client
-	Scheme *runtime.Scheme
+	Scheme  *runtime.Scheme
+	Watcher *watcher.Watcher
 }
 
 //+kubebuilder:rbac:groups=analytics.weave.works,resources=analytics,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=analytics.weave.works,resources=analytics/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=analytics.weave.works,resources=analytics/finalizers,verbs=update
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the Analytic object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
-//
-// For more details, check Reconcile and its Result here:
-// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.13.0/pkg/reconcile
 func (r *AnalyticReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = log.FromContext(ctx)
-	return ctrl.Result{}, nil
+	logger := log.FromContext(ctx)
+
+	var analytic v1alpha1.Analytic
+	if err := r.Get(ctx, req.NamespacedName, &analytic); err != nil {
+		if apierrors.IsNotFound(err) {
+			metrics.Analytics.Delete(req.NamespacedName)
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "unable to get analytic")
+		return ctrl.Result{}, err
+	}
+
+	if !analytic.ObjectMeta.DeletionTimestamp.IsZero() {
+		metrics.Analytics.Delete(req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+
+	if analytic.Spec.Metric == nil {
+		metrics.Analytics.Delete(req.NamespacedName)
+	}
+
+	patch := client.MergeFrom(analytic.DeepCopy())
+
+	now := time.Now()
+	if analytic.Status.ObservedGeneration == analytic.Generation && analytic.Status.LastRunTime != nil {
+		next, scheduled, err := nextRun(analytic.Spec, analytic.Status.LastRunTime.Time)
+		if err == nil {
+			if !scheduled {
+				return ctrl.Result{}, nil
+			}
+			if now.Before(next) {
+				return ctrl.Result{RequeueAfter: next.Sub(now)}, nil
+			}
+		}
+	}
+
+	analytic.Status.ObservedGeneration = analytic.Generation
+
+	if _, _, err := nextRun(analytic.Spec, now); err != nil {
+		analytic.Status.NextRunTime = nil
+		analytic.MarkAsNotReady(err.Error(), InvalidScheduleReason)
+		if err := r.updateStatus(ctx, analytic, patch); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	sink, reason, err := r.querySink(ctx, analytic)
+	if err != nil {
+		analytic.MarkAsNotReady(err.Error(), reason)
+		if err := r.updateStatus(ctx, analytic, patch); err != nil {
+			return ctrl.Result{}, err
+		}
+		switch reason {
+		case SinkNotFoundReason, SinkForbiddenReason:
+			// the sink may be registered, or the access granted, later
+			return ctrl.Result{RequeueAfter: sinkNotFoundRequeueInterval}, nil
+		case AuthorizationFailedReason:
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+	}
+
+	result := v1alpha1.AnalyticResult{Time: metav1.NewTime(now)}
+	var opts sinks.QueryOptions
+	if analytic.Spec.Window != nil {
+		opts.Since = now.Add(-analytic.Spec.Window.Duration)
+		windowStart := metav1.NewTime(opts.Since)
+		result.WindowStart = &windowStart
+	}
+
+	res, err := sink.Query(ctx, analytic.Spec.Query, opts)
+	if err != nil {
+		result.Error = err.Error()
+		analytic.Status.Error = err.Error()
+		analytic.MarkAsNotReady(err.Error(), QueryFailedReason)
+	} else {
+		rows := res.Maps()
+		result.Rows = formatRows(rows)
+		analytic.Status.Error = ""
+		analytic.SetRows(result.Rows)
+		analytic.MarkAsReady(fmt.Sprintf("Query returned %d rows.", len(rows)), QuerySucceededReason)
+
+		if analytic.Spec.Metric != nil {
+			if err := metrics.Analytics.Set(req.NamespacedName, *analytic.Spec.Metric, rows); err != nil {
+				analytic.MarkAsNotReady(err.Error(), InvalidMetricReason)
+			}
+		}
+	}
+
+	analytic.Status.LastRunTime = &result.Time
+	analytic.AddResult(result)
+
+	var requeueAfter time.Duration
+	analytic.Status.NextRunTime = nil
+	if next, scheduled, _ := nextRun(analytic.Spec, now); scheduled {
+		nextRunTime := metav1.NewTime(next)
+		analytic.Status.NextRunTime = &nextRunTime
+		requeueAfter = next.Sub(now)
+	}
+
+	if err := r.updateStatus(ctx, analytic, patch); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
+}
+
+// querySink returns the sink the analytic queries, the reason is the one
+// the analytic is marked as not ready with if it can't be queried.
+// Namespaced sinks are resolved in the namespace of the analytic, cluster
+// sinks hold the events of all the namespaces and are only queried if the
+// service account of the analytic is allowed to.
+func (r *AnalyticReconciler) querySink(ctx context.Context, analytic v1alpha1.Analytic) (watcher.QueryableSink, string, error) {
+	ref := analytic.Spec.SinkRef
+	if strings.Contains(ref.Name, "/") {
+		return nil, InvalidSinkRefReason, errors.New("sinkRef name must not contain a slash")
+	}
+
+	var key string
+	switch ref.Kind {
+	case "", v1alpha1.NamespacedSinkKind:
+		key = watcher.Key(analytic.Namespace, ref.Name)
+	case v1alpha1.SinkKind:
+		allowed, err := r.canQuerySink(ctx, analytic)
+		if err != nil {
+			return nil, AuthorizationFailedReason, fmt.Errorf("failed to authorize the query of sink %s: %w", ref.Name, err)
+		}
+		if !allowed {
+			return nil, SinkForbiddenReason, fmt.Errorf("service account %s is not allowed to query sink %s",
+				serviceAccountName(analytic), ref.Name)
+		}
+		key = ref.Name
+	default:
+		return nil, InvalidSinkRefReason, fmt.Errorf("unsupported sinkRef kind %s", ref.Kind)
+	}
+
+	sink, err := r.Watcher.QueryableSink(key)
+	if errors.Is(err, watcher.ErrSinkNotFound) {
+		return nil, SinkNotFoundReason, err
+	} else if err != nil {
+		return nil, SinkNotQueryableReason, err
+	}
+	return sink, "", nil
+}
+
+// canQuerySink reports whether the service account of the analytic is
+// allowed to create the query subresource of the cluster sink it
+// references, as the users querying it through the query server must be.
+func (r *AnalyticReconciler) canQuerySink(ctx context.Context, analytic v1alpha1.Analytic) (bool, error) {
+	review := authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User: fmt.Sprintf("system:serviceaccount:%s:%s", analytic.Namespace, serviceAccountName(analytic)),
+			Groups: []string{
+				"system:serviceaccounts",
+				"system:serviceaccounts:" + analytic.Namespace,
+				"system:authenticated",
+			},
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Verb:        "create",
+				Group:       v1alpha1.GroupVersion.Group,
+				Version:     v1alpha1.GroupVersion.Version,
+				Resource:    "sinks",
+				Subresource: "query",
+				Name:        analytic.Spec.SinkRef.Name,
+			},
+		},
+	}
+	if err := r.Create(ctx, &review); err != nil {
+		return false, err
+	}
+	return review.Status.Allowed, nil
+}
+
+func serviceAccountName(analytic v1alpha1.Analytic) string {
+	if analytic.Spec.ServiceAccountName == "" {
+		return "default"
+	}
+	return analytic.Spec.ServiceAccountName
+}
+
+// nextRun returns the first run time of the analytic after the given time,
+// scheduled is false if the analytic has neither an interval nor a schedule.
+func nextRun(spec v1alpha1.AnalyticSpec, after time.Time) (next time.Time, scheduled bool, err error) {
+	switch {
+	case spec.Interval != nil && spec.Schedule != "":
+		return time.Time{}, false, fmt.Errorf("interval and schedule are mutually exclusive")
+	case spec.Interval != nil:
+		if spec.Interval.Duration <= 0 {
+			return time.Time{}, false, fmt.Errorf("interval must be positive")
+		}
+		return after.Add(spec.Interval.Duration), true, nil
+	case spec.Schedule != "":
+		schedule, err := cron.ParseStandard(spec.Schedule)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid schedule: %w", err)
+		}
+		return schedule.Next(after), true, nil
+	}
+	return time.Time{}, false, nil
+}
+
+func (r *AnalyticReconciler) updateStatus(ctx context.Context, analytic v1alpha1.Analytic, patch client.Patch) error {
+	if err := r.Status().Patch(ctx, &analytic, patch); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func formatRows(rows []map[string]interface{}) []map[string]string {
+	if len(rows) > maxResultRows {
+		rows = rows[:maxResultRows]
+	}
+
+	result := make([]map[string]string, 0, len(rows))
+	for _, row := range rows {
+		values := make(map[string]string, len(row))
+		for column, value := range row {
+			if value == nil {
+				values[column] = ""
+				continue
+			}
+			values[column] = fmt.Sprint(value)
+		}
+		result = append(result, values)
+	}
+
+	return result
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *AnalyticReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&analyticsweaveworksv1alpha1.Analytic{}).
+		For(
+			&v1alpha1.Analytic{},
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
 		Complete(r)
 }
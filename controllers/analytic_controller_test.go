@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/internal/watcher"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1alpha1 "github.com/ahsayde/analytics-controller/api/v1alpha1"
+)
+
+// reviewingClient answers the subject access reviews with allowed.
+type reviewingClient struct {
+	client.Client
+	allowed bool
+	reviews []authorizationv1.SubjectAccessReview
+}
+
+func (c *reviewingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if review, ok := obj.(*authorizationv1.SubjectAccessReview); ok {
+		review.Status.Allowed = c.allowed
+		c.reviews = append(c.reviews, *review)
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func newTestScheme(t *testing.T) *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return scheme
+}
+
+func TestAnalyticQueriesClusterSink(t *testing.T) {
+	ctx := context.Background()
+
+	w := watcher.New(nil, watcher.Options{})
+	sink := v1alpha1.Sink{
+		ObjectMeta: metav1.ObjectMeta{Name: "events"},
+		Spec: v1alpha1.SinkSpec{
+			SQLite: &v1alpha1.SqliteSink{Path: filepath.Join(t.TempDir(), "events.db")},
+		},
+	}
+	if err := w.RegisterSink(ctx, sink, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer w.RemoveSink("events")
+
+	tests := []struct {
+		name    string
+		allowed bool
+		reason  string
+	}{
+		{name: "allowed", allowed: true, reason: QuerySucceededReason},
+		{name: "forbidden", allowed: false, reason: SinkForbiddenReason},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			analytic := &v1alpha1.Analytic{
+				ObjectMeta: metav1.ObjectMeta{Name: "count", Namespace: "team-a", Generation: 1},
+				Spec: v1alpha1.AnalyticSpec{
+					Query:              "SELECT count(*) AS count FROM events",
+					SinkRef:            v1alpha1.AnalyticSinkReference{Kind: v1alpha1.SinkKind, Name: "events"},
+					ServiceAccountName: "reader",
+				},
+			}
+			c := &reviewingClient{
+				Client:  fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(analytic).Build(),
+				allowed: tt.allowed,
+			}
+			r := &AnalyticReconciler{Client: c, Scheme: c.Scheme(), Watcher: w}
+
+			key := types.NamespacedName{Namespace: "team-a", Name: "count"}
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(c.reviews) != 1 {
+				t.Fatalf("got %d subject access reviews, want 1", len(c.reviews))
+			}
+			spec := c.reviews[0].Spec
+			if spec.User != "system:serviceaccount:team-a:reader" {
+				t.Errorf("reviewed user %s", spec.User)
+			}
+			if attrs := spec.ResourceAttributes; attrs.Resource != "sinks" || attrs.Subresource != "query" || attrs.Name != "events" {
+				t.Errorf("reviewed attributes %+v", attrs)
+			}
+
+			var got v1alpha1.Analytic
+			if err := c.Get(ctx, key, &got); err != nil {
+				t.Fatal(err)
+			}
+			cond := apimeta.FindStatusCondition(got.Status.Conditions, v1alpha1.AnalyticReadyCondition)
+			if cond == nil || cond.Reason != tt.reason {
+				t.Fatalf("got condition %+v, want reason %s", cond, tt.reason)
+			}
+			if tt.allowed && (len(got.Status.Rows) != 1 || got.Status.Rows[0]["count"] != "0") {
+				t.Errorf("got rows %v", got.Status.Rows)
+			}
+		})
+	}
+}
+
+func TestAnalyticDoesNotQueryClusterSinkByDefault(t *testing.T) {
+	ctx := context.Background()
+
+	w := watcher.New(nil, watcher.Options{})
+	sink := v1alpha1.Sink{
+		ObjectMeta: metav1.ObjectMeta{Name: "events"},
+		Spec: v1alpha1.SinkSpec{
+			SQLite: &v1alpha1.SqliteSink{Path: filepath.Join(t.TempDir(), "events.db")},
+		},
+	}
+	if err := w.RegisterSink(ctx, sink, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer w.RemoveSink("events")
+
+	analytic := &v1alpha1.Analytic{
+		ObjectMeta: metav1.ObjectMeta{Name: "count", Namespace: "team-a", Generation: 1},
+		Spec: v1alpha1.AnalyticSpec{
+			Query:   "SELECT count(*) AS count FROM events",
+			SinkRef: v1alpha1.AnalyticSinkReference{Name: "events"},
+		},
+	}
+	c := &reviewingClient{
+		Client:  fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(analytic).Build(),
+		allowed: true,
+	}
+	r := &AnalyticReconciler{Client: c, Scheme: c.Scheme(), Watcher: w}
+
+	key := types.NamespacedName{Namespace: "team-a", Name: "count"}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got v1alpha1.Analytic
+	if err := c.Get(ctx, key, &got); err != nil {
+		t.Fatal(err)
+	}
+	cond := apimeta.FindStatusCondition(got.Status.Conditions, v1alpha1.AnalyticReadyCondition)
+	if cond == nil || cond.Reason != SinkNotFoundReason {
+		t.Fatalf("got condition %+v, want reason %s", cond, SinkNotFoundReason)
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	after := time.Date(2023, 1, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		spec      v1alpha1.AnalyticSpec
+		next      time.Time
+		scheduled bool
+		err       bool
+	}{
+		{name: "unscheduled"},
+		{
+			name:      "interval",
+			spec:      v1alpha1.AnalyticSpec{Interval: &metav1.Duration{Duration: 5 * time.Minute}},
+			next:      after.Add(5 * time.Minute),
+			scheduled: true,
+		},
+		{
+			name: "non positive interval",
+			spec: v1alpha1.AnalyticSpec{Interval: &metav1.Duration{}},
+			err:  true,
+		},
+		{
+			name:      "schedule",
+			spec:      v1alpha1.AnalyticSpec{Schedule: "0 * * * *"},
+			next:      time.Date(2023, 1, 1, 13, 0, 0, 0, time.UTC),
+			scheduled: true,
+		},
+		{
+			name: "invalid schedule",
+			spec: v1alpha1.AnalyticSpec{Schedule: "every hour"},
+			err:  true,
+		},
+		{
+			name: "interval and schedule",
+			spec: v1alpha1.AnalyticSpec{Interval: &metav1.Duration{Duration: time.Minute}, Schedule: "0 * * * *"},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, scheduled, err := nextRun(tt.spec, after)
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %t", err, tt.err)
+			}
+			if scheduled != tt.scheduled || !next.Equal(tt.next) {
+				t.Errorf("got next run %s scheduled %t, want %s scheduled %t", next, scheduled, tt.next, tt.scheduled)
+			}
+		})
+	}
+}
+
+func TestFormatRows(t *testing.T) {
+	rows := []map[string]interface{}{
+		{"reason": "BackOff", "count": int64(3), "ratio": 0.5, "note": nil, "failed": true},
+	}
+	got := formatRows(rows)
+	want := map[string]string{"reason": "BackOff", "count": "3", "ratio": "0.5", "note": "", "failed": "true"}
+	if len(got) != 1 || fmt.Sprint(got[0]) != fmt.Sprint(want) {
+		t.Errorf("got rows %v, want %v", got, want)
+	}
+
+	many := make([]map[string]interface{}, maxResultRows+10)
+	for i := range many {
+		many[i] = map[string]interface{}{"index": i}
+	}
+	got = formatRows(many)
+	if len(got) != maxResultRows {
+		t.Fatalf("expected the rows to be capped to %d, got %d", maxResultRows, len(got))
+	}
+	if got[maxResultRows-1]["index"] != fmt.Sprint(maxResultRows-1) {
+		t.Errorf("expected the first rows to be kept, got %v", got[maxResultRows-1])
+	}
+
+	if got := formatRows(nil); got == nil || len(got) != 0 {
+		t.Errorf("expected no rows, got %v", got)
+	}
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/internal/watcher"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	v1alpha1 "github.com/ahsayde/analytics-controller/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	SinkRefsResolvedReason    = "SinkRefsResolved"
+	InvalidFilterReason       = "InvalidFilter"
+	InvalidExpressionReason   = "InvalidExpression"
+	NamespaceNotWatchedReason = "NamespaceNotWatched"
+
+	sinkRefsIndexKey = "spec.sinkRefs"
+
+	// eventSetStatusInterval is the interval the matched events of an
+	// event set are reported at.
+	eventSetStatusInterval = 30 * time.Second
+)
+
+// EventSetReconciler reconciles a EventSet object
+type EventSetReconciler struct {
+	client.Client
+	Scheme  *runtime.Scheme
+	Watcher *watcher.Watcher
+}
+
+//+kubebuilder:rbac:groups=analytics.weave.works,resources=eventsets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=analytics.weave.works,resources=eventsets/status,verbs=get;update;patch
+
+func (r *EventSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var eventSet v1alpha1.EventSet
+	if err := r.Get(ctx, req.NamespacedName, &eventSet); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Watcher.RemoveEventSet(req.Name)
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "unable to get event set")
+		return ctrl.Result{}, err
+	}
+
+	patch := client.MergeFrom(eventSet.DeepCopy())
+
+	eventSet.Status.ObservedGeneration = eventSet.Generation
+
+	setEventSetStatus(r.Watcher, &eventSet, eventSet.Validate())
+
+	if err := r.updateStatus(ctx, eventSet, patch); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: eventSetStatusInterval}, nil
+}
+
+// setEventSetStatus reports the status of the event set given its
+// validation errors, and the events it matched. Namespaced event sets are
+// reported as the EventSet sharing their metadata, spec and status.
+func setEventSetStatus(w *watcher.Watcher, eventSet *v1alpha1.EventSet, errs field.ErrorList) {
+	setReady(w, eventSet, errs)
+
+	setSinkRefsResolved(w, eventSet)
+
+	matches := w.EventSetMatches(watcher.Key(eventSet.Namespace, eventSet.Name))
+	eventSet.Status.MatchedEvents = matches.Count
+	if !matches.LastMatch.IsZero() {
+		lastMatch := metav1.NewTime(matches.LastMatch)
+		eventSet.Status.LastMatchTime = &lastMatch
+	}
+}
+
+// setReady reports whether the filters and the expression of the event set
+// are valid, compiling the expression and watching the labels its
+// selectors match for the watcher, and whether its namespaces are watched.
+// Namespaced event sets only need their own.
+func setReady(w *watcher.Watcher, eventSet *v1alpha1.EventSet, errs field.ErrorList) {
+	if len(errs) > 0 {
+		eventSet.MarkAsNotReady(errs.ToAggregate().Error(), InvalidFilterReason)
+		return
+	}
+	w.WatchLabels(&eventSet.Spec)
+	if eventSet.Spec.Expression != "" {
+		if err := w.CompileExpression(watcher.Key(eventSet.Namespace, eventSet.Name), eventSet.Spec.Expression); err != nil {
+			eventSet.MarkAsNotReady(fmt.Sprintf("invalid expression: %s", err), InvalidExpressionReason)
+			return
+		}
+	}
+	namespaces := eventSet.Spec.Namespaces
+	if eventSet.Namespace != "" {
+		namespaces = []string{eventSet.Namespace}
+	}
+	if unwatched := w.UnwatchedNamespaces(namespaces); len(unwatched) > 0 {
+		message := fmt.Sprintf("Namespaces not watched by the controller: %s", strings.Join(unwatched, ", "))
+		eventSet.MarkAsNotReady(message, NamespaceNotWatchedReason)
+		return
+	}
+	eventSet.MarkAsReady("Event set is ready.", AvailableReason)
+}
+
+// setSinkRefsResolved reports whether all the sinks referenced by the event
+// set are registered, the events written to the others are lost. The
+// sinkRefs of namespaced event sets reference the sinks of their namespace.
+func setSinkRefsResolved(w *watcher.Watcher, eventSet *v1alpha1.EventSet) {
+	var missing []string
+	for _, ref := range eventSet.Spec.SinkRefs {
+		if _, ok := w.GetSink(watcher.Key(eventSet.Namespace, ref.Name)); !ok {
+			missing = append(missing, ref.Name)
+		}
+	}
+
+	if len(missing) > 0 {
+		message := fmt.Sprintf("Sinks not found or not ready: %s", strings.Join(missing, ", "))
+		eventSet.MarkAsSinkRefsNotResolved(message, SinkNotFoundReason)
+		return
+	}
+	eventSet.MarkAsSinkRefsResolved("All referenced sinks are ready.", SinkRefsResolvedReason)
+}
+
+func (r *EventSetReconciler) updateStatus(ctx context.Context, eventSet v1alpha1.EventSet, patch client.Patch) error {
+	if err := r.Status().Patch(ctx, &eventSet, patch); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func sinkRefsIndexHandler(obj client.Object) []string {
+	var spec *v1alpha1.EventSetSpec
+	switch eventSet := obj.(type) {
+	case *v1alpha1.EventSet:
+		spec = &eventSet.Spec
+	case *v1alpha1.NamespacedEventSet:
+		spec = &eventSet.Spec
+	default:
+		return nil
+	}
+
+	var names []string
+	for _, ref := range spec.SinkRefs {
+		names = append(names, ref.Name)
+	}
+	return names
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *EventSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	ctx := context.Background()
+	err := mgr.GetFieldIndexer().IndexField(
+		ctx,
+		&v1alpha1.EventSet{},
+		sinkRefsIndexKey,
+		sinkRefsIndexHandler,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(
+			&v1alpha1.EventSet{},
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Watches(
+			&source.Kind{Type: &v1alpha1.Sink{}},
+			handler.EnqueueRequestsFromMapFunc(r.sinkWatcher),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+		).
+		Complete(r)
+}
+
+// sinkWatcher enqueues the event sets referencing the sink, so that they
+// are resolved again when it is registered or removed.
+func (r *EventSetReconciler) sinkWatcher(obj client.Object) []reconcile.Request {
+	opts := client.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector(sinkRefsIndexKey, obj.GetName()),
+	}
+
+	var list v1alpha1.EventSetList
+	ctx := context.Background()
+	if err := r.List(ctx, &list, &opts); err != nil {
+		log.Log.Error(err, "")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name: item.Name,
+			},
+		})
+	}
+
+	return requests
+}
@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	v1alpha1 "github.com/ahsayde/analytics-controller/api/v1alpha1"
+	"github.com/ahsayde/analytics-controller/internal/watcher"
+)
+
+// registerSinks registers the cluster sink events and the namespaced sink
+// team-a/audit, which is a webhook as namespaced sinks can't be sqlite.
+func registerSinks(t *testing.T, w *watcher.Watcher) {
+	ctx := context.Background()
+	sink := v1alpha1.Sink{
+		ObjectMeta: metav1.ObjectMeta{Name: "events"},
+		Spec: v1alpha1.SinkSpec{
+			SQLite: &v1alpha1.SqliteSink{Path: filepath.Join(t.TempDir(), "events.db")},
+		},
+	}
+	if err := w.RegisterSink(ctx, sink, nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.RemoveSink("events") })
+
+	namespacedSink := v1alpha1.NamespacedSink{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "team-a", Name: "audit"},
+		Spec: v1alpha1.SinkSpec{
+			Webhook: &v1alpha1.WebhookSink{Endpoint: "http://audit.team-a.svc"},
+		},
+	}
+	if err := w.RegisterNamespacedSink(ctx, namespacedSink, nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.RemoveSink(watcher.Key("team-a", "audit")) })
+}
+
+func sinkRefs(names ...string) []corev1.LocalObjectReference {
+	refs := make([]corev1.LocalObjectReference, 0, len(names))
+	for _, name := range names {
+		refs = append(refs, corev1.LocalObjectReference{Name: name})
+	}
+	return refs
+}
+
+func TestSetSinkRefsResolved(t *testing.T) {
+	w := watcher.New(nil, watcher.Options{})
+	registerSinks(t, w)
+
+	tests := []struct {
+		name      string
+		namespace string
+		refs      []corev1.LocalObjectReference
+		status    metav1.ConditionStatus
+		reason    string
+		message   string
+	}{
+		{name: "no sinks", status: metav1.ConditionTrue, reason: SinkRefsResolvedReason},
+		{name: "registered sink", refs: sinkRefs("events"), status: metav1.ConditionTrue, reason: SinkRefsResolvedReason},
+		{
+			name:    "missing sinks",
+			refs:    sinkRefs("a", "events", "b"),
+			status:  metav1.ConditionFalse,
+			reason:  SinkNotFoundReason,
+			message: "Sinks not found or not ready: a, b",
+		},
+		{
+			name:    "namespaced sink referenced by a cluster event set",
+			refs:    sinkRefs("audit"),
+			status:  metav1.ConditionFalse,
+			reason:  SinkNotFoundReason,
+			message: "Sinks not found or not ready: audit",
+		},
+		{name: "namespaced sink", namespace: "team-a", refs: sinkRefs("audit"), status: metav1.ConditionTrue, reason: SinkRefsResolvedReason},
+		{
+			name:      "cluster sink referenced by a namespaced event set",
+			namespace: "team-a",
+			refs:      sinkRefs("events"),
+			status:    metav1.ConditionFalse,
+			reason:    SinkNotFoundReason,
+			message:   "Sinks not found or not ready: events",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			eventSet := &v1alpha1.EventSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: tt.namespace, Name: "set"},
+				Spec:       v1alpha1.EventSetSpec{SinkRefs: tt.refs},
+			}
+			setSinkRefsResolved(w, eventSet)
+
+			cond := apimeta.FindStatusCondition(eventSet.Status.Conditions, v1alpha1.EventSetSinkRefsResolvedCondition)
+			if cond == nil || cond.Status != tt.status || cond.Reason != tt.reason {
+				t.Fatalf("got condition %+v, want %s with reason %s", cond, tt.status, tt.reason)
+			}
+			if tt.message != "" && cond.Message != tt.message {
+				t.Errorf("got message %q, want %q", cond.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestSetEventSetStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces []string
+		namespace  string
+		spec       v1alpha1.EventSetSpec
+		errs       field.ErrorList
+		status     metav1.ConditionStatus
+		reason     string
+	}{
+		{name: "ready", spec: v1alpha1.EventSetSpec{Expression: `event.count > 5`}, status: metav1.ConditionTrue, reason: AvailableReason},
+		{
+			name:   "invalid filter",
+			errs:   field.ErrorList{field.Invalid(field.NewPath("spec", "match", "reasons").Index(0), "(", "invalid pattern")},
+			status: metav1.ConditionFalse,
+			reason: InvalidFilterReason,
+		},
+		{name: "invalid expression", spec: v1alpha1.EventSetSpec{Expression: `event.count >`}, status: metav1.ConditionFalse, reason: InvalidExpressionReason},
+		{
+			name:       "unwatched namespace",
+			namespaces: []string{"team-a"},
+			spec:       v1alpha1.EventSetSpec{Namespaces: []string{"team-a", "team-b"}},
+			status:     metav1.ConditionFalse,
+			reason:     NamespaceNotWatchedReason,
+		},
+		{
+			name:       "namespaced event set in a watched namespace",
+			namespaces: []string{"team-a"},
+			namespace:  "team-a",
+			spec:       v1alpha1.EventSetSpec{Namespaces: []string{"team-b"}},
+			status:     metav1.ConditionTrue,
+			reason:     AvailableReason,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := watcher.New(nil, watcher.Options{Namespaces: tt.namespaces})
+			eventSet := &v1alpha1.EventSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: tt.namespace, Name: "set"},
+				Spec:       tt.spec,
+			}
+			setEventSetStatus(w, eventSet, tt.errs)
+
+			ready := apimeta.FindStatusCondition(eventSet.Status.Conditions, v1alpha1.EventSetReadyCondition)
+			if ready == nil || ready.Status != tt.status || ready.Reason != tt.reason {
+				t.Fatalf("got ready condition %+v, want %s with reason %s", ready, tt.status, tt.reason)
+			}
+			// the sink references are reported whether the event set is
+			// ready or not.
+			if apimeta.FindStatusCondition(eventSet.Status.Conditions, v1alpha1.EventSetSinkRefsResolvedCondition) == nil {
+				t.Error("expected the sink references to be reported")
+			}
+			if eventSet.Status.MatchedEvents != 0 || eventSet.Status.LastMatchTime != nil {
+				t.Errorf("got %d matched events last matched at %v, want none", eventSet.Status.MatchedEvents, eventSet.Status.LastMatchTime)
+			}
+		})
+	}
+}
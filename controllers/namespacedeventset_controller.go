@@ -0,0 +1,146 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/ahsayde/analytics-controller/internal/watcher"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	v1alpha1 "github.com/ahsayde/analytics-controller/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// NamespacedEventSetReconciler reconciles a NamespacedEventSet object
+type NamespacedEventSetReconciler struct {
+	client.Client
+	Scheme  *runtime.Scheme
+	Watcher *watcher.Watcher
+}
+
+//+kubebuilder:rbac:groups=analytics.weave.works,resources=namespacedeventsets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=analytics.weave.works,resources=namespacedeventsets/status,verbs=get;update;patch
+
+func (r *NamespacedEventSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var namespacedEventSet v1alpha1.NamespacedEventSet
+	if err := r.Get(ctx, req.NamespacedName, &namespacedEventSet); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Watcher.RemoveEventSet(watcher.Key(req.Namespace, req.Name))
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "unable to get namespaced event set")
+		return ctrl.Result{}, err
+	}
+
+	patch := client.MergeFrom(namespacedEventSet.DeepCopy())
+
+	// the status is reported on the event set sharing the metadata, spec
+	// and status of the namespaced event set and copied back.
+	eventSet := v1alpha1.EventSet{
+		ObjectMeta: namespacedEventSet.ObjectMeta,
+		Spec:       namespacedEventSet.Spec,
+		Status:     namespacedEventSet.Status,
+	}
+	eventSet.Status.ObservedGeneration = eventSet.Generation
+
+	setEventSetStatus(r.Watcher, &eventSet, namespacedEventSet.Validate())
+
+	namespacedEventSet.Status = eventSet.Status
+	if err := r.updateStatus(ctx, namespacedEventSet, patch); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: eventSetStatusInterval}, nil
+}
+
+func (r *NamespacedEventSetReconciler) updateStatus(ctx context.Context, eventSet v1alpha1.NamespacedEventSet, patch client.Patch) error {
+	if err := r.Status().Patch(ctx, &eventSet, patch); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NamespacedEventSetReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	ctx := context.Background()
+	err := mgr.GetFieldIndexer().IndexField(
+		ctx,
+		&v1alpha1.NamespacedEventSet{},
+		sinkRefsIndexKey,
+		sinkRefsIndexHandler,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(
+			&v1alpha1.NamespacedEventSet{},
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Watches(
+			&source.Kind{Type: &v1alpha1.NamespacedSink{}},
+			handler.EnqueueRequestsFromMapFunc(r.sinkWatcher),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+		).
+		Complete(r)
+}
+
+// sinkWatcher enqueues the event sets of the namespace referencing the
+// sink, so that they are resolved again when it is registered or removed.
+func (r *NamespacedEventSetReconciler) sinkWatcher(obj client.Object) []reconcile.Request {
+	opts := client.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector(sinkRefsIndexKey, obj.GetName()),
+		Namespace:     obj.GetNamespace(),
+	}
+
+	var list v1alpha1.NamespacedEventSetList
+	ctx := context.Background()
+	if err := r.List(ctx, &list, &opts); err != nil {
+		log.Log.Error(err, "")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: item.Namespace,
+				Name:      item.Name,
+			},
+		})
+	}
+
+	return requests
+}
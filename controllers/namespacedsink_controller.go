@@ -0,0 +1,203 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ahsayde/analytics-controller/internal/watcher"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	v1alpha1 "github.com/ahsayde/analytics-controller/api/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// NamespacedSinkReconciler reconciles a NamespacedSink object
+type NamespacedSinkReconciler struct {
+	client.Client
+	Scheme  *runtime.Scheme
+	Watcher *watcher.Watcher
+}
+
+//+kubebuilder:rbac:groups=analytics.weave.works,resources=namespacedsinks,verbs=get;list;watch
+//+kubebuilder:rbac:groups=analytics.weave.works,resources=namespacedsinks/status,verbs=get;update;patch
+
+func (r *NamespacedSinkReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var namespacedSink v1alpha1.NamespacedSink
+	if err := r.Get(ctx, req.NamespacedName, &namespacedSink); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Watcher.RemoveSink(watcher.Key(req.Namespace, req.Name))
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "unable to get namespaced sink")
+		return ctrl.Result{}, err
+	}
+
+	patch := client.MergeFrom(namespacedSink.DeepCopy())
+
+	// the status is reported on the sink sharing the metadata, spec and
+	// status of the namespaced sink and copied back.
+	sink := v1alpha1.Sink{
+		ObjectMeta: namespacedSink.ObjectMeta,
+		Spec:       namespacedSink.Spec,
+		Status:     namespacedSink.Status,
+	}
+	sink.Status.ObservedGeneration = sink.Generation
+
+	result, registerErr := r.register(ctx, namespacedSink, &sink)
+
+	namespacedSink.Status = sink.Status
+	if err := r.updateStatus(ctx, namespacedSink, patch); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return result, registerErr
+}
+
+// register registers the namespaced sink with the watcher. Its secret is
+// only read once the sink is known not to reference another namespace. The
+// error is returned if the sink failed to start, so that it is retried.
+func (r *NamespacedSinkReconciler) register(ctx context.Context, namespacedSink v1alpha1.NamespacedSink, sink *v1alpha1.Sink) (ctrl.Result, error) {
+	if errs := namespacedSink.Validate(); len(errs) > 0 {
+		r.Watcher.RemoveSink(watcher.Key(namespacedSink.Namespace, namespacedSink.Name))
+		sink.MarkAsNotReady(errs.ToAggregate().Error(), ForbiddenFieldReason)
+		return ctrl.Result{}, nil
+	}
+
+	var secretConf map[string]string
+	if ref := namespacedSink.Spec.SecretRef; ref != nil {
+		var err error
+		secretConf, err = getConfigFromSecret(ctx, r.Client, &v1.SecretReference{
+			Name:      ref.Name,
+			Namespace: namespacedSink.Namespace,
+		})
+		if err != nil {
+			sink.MarkAsNotReady(err.Error(), InvalidSecretReason)
+			return ctrl.Result{}, nil
+		}
+	}
+
+	if err := r.Watcher.RegisterNamespacedSink(ctx, namespacedSink, secretConf); err != nil {
+		sink.MarkAsNotReady(err.Error(), FailedToStartReason)
+		return ctrl.Result{}, err
+	}
+
+	setSinkHealth(r.Watcher, sink)
+	setDroppedEvents(r.Watcher, sink)
+
+	return ctrl.Result{RequeueAfter: sinkStatusInterval}, nil
+}
+
+func (r *NamespacedSinkReconciler) updateStatus(ctx context.Context, sink v1alpha1.NamespacedSink, patch client.Patch) error {
+	if err := r.Status().Patch(ctx, &sink, patch); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// namespacedSecretRefIndexHandler indexes the namespaced sinks by their
+// secret, which is always read from their own namespace.
+func namespacedSecretRefIndexHandler(obj client.Object) []string {
+	sink, ok := obj.(*v1alpha1.NamespacedSink)
+	if !ok {
+		return nil
+	}
+	if sink.Spec.SecretRef == nil {
+		return nil
+	}
+
+	return []string{
+		fmt.Sprintf(
+			"%s/%s",
+			sink.Namespace,
+			sink.Spec.SecretRef.Name,
+		),
+	}
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NamespacedSinkReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	ctx := context.Background()
+	err := mgr.GetFieldIndexer().IndexField(
+		ctx,
+		&v1alpha1.NamespacedSink{},
+		secretRefIndexKey,
+		namespacedSecretRefIndexHandler,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(
+			&v1alpha1.NamespacedSink{},
+			// status updates would reconcile again right away and report
+			// the events dropped since the previous one as none.
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Watches(
+			&source.Kind{Type: &v1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.secretWatcher),
+			builder.WithPredicates(predicate.ResourceVersionChangedPredicate{}),
+		).
+		Complete(r)
+}
+
+func (r *NamespacedSinkReconciler) secretWatcher(obj client.Object) []reconcile.Request {
+	key := fmt.Sprintf("%s/%s", obj.GetNamespace(), obj.GetName())
+	opts := client.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector(secretRefIndexKey, key),
+		Namespace:     obj.GetNamespace(),
+	}
+
+	var list v1alpha1.NamespacedSinkList
+	ctx := context.Background()
+	if err := r.List(ctx, &list, &opts); err != nil {
+		log.Log.Error(err, "")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, item := range list.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Namespace: item.Namespace,
+				Name:      item.Name,
+			},
+		})
+	}
+
+	return requests
+}
@@ -20,7 +20,9 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/ahsayde/analytics-controller/internal/sinks"
 	"github.com/ahsayde/analytics-controller/internal/watcher"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/fields"
@@ -37,14 +39,30 @@ import (
 
 	v1alpha1 "github.com/ahsayde/analytics-controller/api/v1alpha1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 const (
 	AvailableReason     = "Available"
 	FailedToStartReason = "FailedToStart"
 	InvalidSecretReason = "InvalidSecret"
+	// ForbiddenFieldReason is reported by the namespaced sinks using what
+	// a tenant isn't allowed to.
+	ForbiddenFieldReason = "ForbiddenField"
+
+	QueueOverflowReason   = "QueueOverflow"
+	NoEventsDroppedReason = "NoEventsDropped"
+
+	DeliverySucceedingReason = "DeliverySucceeding"
+	DeliveryFailingReason    = "DeliveryFailing"
+	CircuitOpenReason        = "CircuitOpen"
 
 	secretRefIndexKey = "spec.secretRef"
+
+	// sinkStatusInterval is the interval the health and dropped events of
+	// a sink are reported at.
+	sinkStatusInterval = 30 * time.Second
 )
 
 // SinkReconciler reconciles a Sink object
@@ -57,6 +75,7 @@ type SinkReconciler struct {
 //+kubebuilder:rbac:groups=analytics.weave.works,resources=sinks,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=analytics.weave.works,resources=sinks/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=analytics.weave.works,resources=sinks/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 
 func (r *SinkReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
@@ -64,6 +83,7 @@ func (r *SinkReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 	var sink v1alpha1.Sink
 	if err := r.Get(ctx, req.NamespacedName, &sink); err != nil {
 		if apierrors.IsNotFound(err) {
+			r.Watcher.RemoveSink(req.Name)
 			return ctrl.Result{}, nil
 		}
 		logger.Error(err, "unable to get sink")
@@ -83,7 +103,7 @@ func (r *SinkReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 	var err error
 
 	if sink.Spec.SecretRef != nil {
-		secretConf, err = r.getConfigFromSecret(ctx, sink.Spec.SecretRef)
+		secretConf, err = getConfigFromSecret(ctx, r.Client, sink.Spec.SecretRef)
 		if err != nil {
 			sink.MarkAsNotReady(err.Error(), InvalidSecretReason)
 			if err := r.updateStatus(ctx, sink, patch); err != nil {
@@ -95,25 +115,95 @@ func (r *SinkReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 
 	if err := r.Watcher.RegisterSink(ctx, sink, secretConf); err != nil {
 		sink.MarkAsNotReady(err.Error(), FailedToStartReason)
-	} else {
-		sink.MarkAsReady("Sink is ready.", AvailableReason)
+		if err := r.updateStatus(ctx, sink, patch); err != nil {
+			return ctrl.Result{}, err
+		}
+		// the backend may only be unreachable for now, retry with backoff
+		return ctrl.Result{}, err
 	}
 
+	setSinkHealth(r.Watcher, &sink)
+	setDroppedEvents(r.Watcher, &sink)
+
 	if err := r.updateStatus(ctx, sink, patch); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: sinkStatusInterval}, nil
+}
+
+// setSinkHealth reports whether the registered sink is ready and its
+// delivery health, a sink whose circuit breaker is open is not ready.
+// Namespaced sinks are reported as the Sink sharing their metadata, spec
+// and status.
+func setSinkHealth(w *watcher.Watcher, sink *v1alpha1.Sink) {
+	health, ok := w.SinkHealth(watcher.Key(sink.Namespace, sink.Name))
+	setHealth(sink, health, ok)
 }
 
-func (r *SinkReconciler) getConfigFromSecret(ctx context.Context, secretRef *v1.SecretReference) (map[string]string, error) {
+// setHealth sets the Ready condition once, so that it only transitions when
+// the readiness of the sink changes. ok is false for the sinks not tracking
+// their delivery health.
+func setHealth(sink *v1alpha1.Sink, health sinks.Health, ok bool) {
+	if !ok {
+		sink.Status.Health = nil
+		apimeta.RemoveStatusCondition(&sink.Status.Conditions, v1alpha1.SinkHealthyCondition)
+		sink.MarkAsReady("Sink is ready.", AvailableReason)
+		return
+	}
+
+	status := v1alpha1.SinkHealth{
+		ConsecutiveFailures: health.ConsecutiveFailures,
+		LastError:           health.LastError,
+		CircuitOpen:         health.CircuitOpen,
+	}
+	if !health.LastSuccess.IsZero() {
+		lastSuccess := metav1.NewTime(health.LastSuccess)
+		status.LastSuccessTime = &lastSuccess
+	}
+	if !health.LastFailure.IsZero() {
+		lastFailure := metav1.NewTime(health.LastFailure)
+		status.LastFailureTime = &lastFailure
+	}
+	sink.Status.Health = &status
+
+	switch {
+	case health.CircuitOpen:
+		message := fmt.Sprintf("Writes are suspended after %d consecutive failures: %s", health.ConsecutiveFailures, health.LastError)
+		sink.MarkAsDegraded(message, CircuitOpenReason)
+		sink.MarkAsNotReady(message, CircuitOpenReason)
+		return
+	case health.ConsecutiveFailures > 0:
+		message := fmt.Sprintf("%d consecutive writes failed: %s", health.ConsecutiveFailures, health.LastError)
+		sink.MarkAsDegraded(message, DeliveryFailingReason)
+	default:
+		sink.MarkAsHealthy("Events are delivered.", DeliverySucceedingReason)
+	}
+	sink.MarkAsReady("Sink is ready.", AvailableReason)
+}
+
+// setDroppedEvents reports whether the sink queue dropped events, because
+// it was full or they failed to be delivered, since the status was last
+// updated.
+func setDroppedEvents(w *watcher.Watcher, sink *v1alpha1.Sink) {
+	dropped := w.DroppedEvents(watcher.Key(sink.Namespace, sink.Name))
+	if dropped > sink.Status.DroppedEvents {
+		message := fmt.Sprintf("%d events were dropped since the last check, the queue is full or they failed to be delivered.", dropped-sink.Status.DroppedEvents)
+		sink.MarkAsDroppingEvents(message, QueueOverflowReason)
+	} else {
+		sink.MarkAsNotDroppingEvents("No events were dropped since the last check.", NoEventsDroppedReason)
+	}
+	sink.Status.DroppedEvents = dropped
+}
+
+func getConfigFromSecret(ctx context.Context, c client.Client, secretRef *v1.SecretReference) (map[string]string, error) {
 	var secret v1.Secret
 	key := client.ObjectKey{
 		Name:      secretRef.Name,
 		Namespace: secretRef.Namespace,
 	}
 
-	if err := r.Get(ctx, key, &secret); err != nil {
+	if err := c.Get(ctx, key, &secret); err != nil {
 		if apierrors.IsNotFound(err) {
 			return nil, err
 		}
@@ -171,7 +261,12 @@ func (r *SinkReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	}
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&v1alpha1.Sink{}).
+		For(
+			&v1alpha1.Sink{},
+			// status updates would reconcile again right away and report
+			// the events dropped since the previous one as none.
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
 		Watches(
 			&source.Kind{Type: &v1.Secret{}},
 			handler.EnqueueRequestsFromMapFunc(r.secretWatcher),
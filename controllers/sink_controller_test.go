@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1alpha1 "github.com/ahsayde/analytics-controller/api/v1alpha1"
+	"github.com/ahsayde/analytics-controller/internal/sinks"
+	"github.com/ahsayde/analytics-controller/internal/watcher"
+)
+
+func TestSetHealthKeepsReadyTransitionTime(t *testing.T) {
+	opened := metav1.NewTime(time.Now().Add(-time.Hour).Truncate(time.Second))
+	sink := v1alpha1.Sink{}
+	sink.Status.Conditions = []metav1.Condition{{
+		Type:               v1alpha1.SinkReadyCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             CircuitOpenReason,
+		LastTransitionTime: opened,
+	}}
+
+	open := sinks.Health{ConsecutiveFailures: 5, LastError: "unavailable", CircuitOpen: true}
+	setHealth(&sink, open, true)
+
+	ready := apimeta.FindStatusCondition(sink.Status.Conditions, v1alpha1.SinkReadyCondition)
+	if ready.Status != metav1.ConditionFalse || ready.Reason != CircuitOpenReason {
+		t.Fatalf("got ready condition %+v", ready)
+	}
+	if !ready.LastTransitionTime.Equal(&opened) {
+		t.Errorf("ready transitioned at %s, want %s", ready.LastTransitionTime, opened)
+	}
+	healthy := apimeta.FindStatusCondition(sink.Status.Conditions, v1alpha1.SinkHealthyCondition)
+	if healthy == nil || healthy.Status != metav1.ConditionFalse {
+		t.Fatalf("got healthy condition %+v", healthy)
+	}
+}
+
+func TestSetHealth(t *testing.T) {
+	tests := []struct {
+		name    string
+		health  sinks.Health
+		ok      bool
+		ready   metav1.ConditionStatus
+		healthy string
+	}{
+		{name: "untracked", ready: metav1.ConditionTrue},
+		{name: "delivering", ok: true, ready: metav1.ConditionTrue, healthy: DeliverySucceedingReason},
+		{name: "failing", health: sinks.Health{ConsecutiveFailures: 2}, ok: true, ready: metav1.ConditionTrue, healthy: DeliveryFailingReason},
+		{name: "circuit open", health: sinks.Health{ConsecutiveFailures: 5, CircuitOpen: true}, ok: true, ready: metav1.ConditionFalse, healthy: CircuitOpenReason},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sink v1alpha1.Sink
+			setHealth(&sink, tt.health, tt.ok)
+
+			if ready := apimeta.FindStatusCondition(sink.Status.Conditions, v1alpha1.SinkReadyCondition); ready.Status != tt.ready {
+				t.Errorf("got ready %s, want %s", ready.Status, tt.ready)
+			}
+			healthy := apimeta.FindStatusCondition(sink.Status.Conditions, v1alpha1.SinkHealthyCondition)
+			if tt.healthy == "" {
+				if healthy != nil || sink.Status.Health != nil {
+					t.Errorf("got healthy condition %+v for an untracked sink", healthy)
+				}
+				return
+			}
+			if healthy == nil || healthy.Reason != tt.healthy {
+				t.Errorf("got healthy condition %+v, want reason %s", healthy, tt.healthy)
+			}
+		})
+	}
+}
+
+func TestSinkProbe(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		status int
+		ready  metav1.ConditionStatus
+		reason string
+	}{
+		{name: "reachable", status: http.StatusOK, ready: metav1.ConditionTrue, reason: AvailableReason},
+		{name: "server error", status: http.StatusInternalServerError, ready: metav1.ConditionFalse, reason: FailedToStartReason},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			sink := &v1alpha1.Sink{
+				ObjectMeta: metav1.ObjectMeta{Name: "webhook", Generation: 1},
+				Spec: v1alpha1.SinkSpec{
+					Webhook: &v1alpha1.WebhookSink{Endpoint: server.URL, Probe: true},
+				},
+			}
+			c := fake.NewClientBuilder().WithScheme(newTestScheme(t)).WithObjects(sink).Build()
+			w := watcher.New(nil, watcher.Options{})
+			defer w.RemoveSink("webhook")
+			r := &SinkReconciler{Client: c, Scheme: c.Scheme(), Watcher: w}
+
+			key := types.NamespacedName{Name: "webhook"}
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			if (err != nil) != (tt.reason == FailedToStartReason) {
+				t.Fatalf("got error %v", err)
+			}
+
+			var got v1alpha1.Sink
+			if err := c.Get(ctx, key, &got); err != nil {
+				t.Fatal(err)
+			}
+			ready := apimeta.FindStatusCondition(got.Status.Conditions, v1alpha1.SinkReadyCondition)
+			if ready == nil || ready.Status != tt.ready || ready.Reason != tt.reason {
+				t.Fatalf("got ready condition %+v, want %s with reason %s", ready, tt.ready, tt.reason)
+			}
+			if _, ok := w.SinkHealth("webhook"); ok != (tt.ready == metav1.ConditionTrue) {
+				t.Errorf("expected the sink to be registered only when its probe succeeds")
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package checkpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;create;update
+
+// Checkpoint marks the latest event delivered.
+type Checkpoint struct {
+	// LastTimestamp time of the latest occurrence of the event.
+	LastTimestamp metav1.Time `json:"lastTimestamp"`
+	// UID of the event.
+	UID types.UID `json:"uid,omitempty"`
+	// Count of the event.
+	Count int32 `json:"count,omitempty"`
+}
+
+// IsZero reports whether the checkpoint marks no event.
+func (c Checkpoint) IsZero() bool {
+	return c.LastTimestamp.IsZero()
+}
+
+// Store persists checkpoints by name in a ConfigMap.
+type Store struct {
+	client client.Client
+	// reader reads the ConfigMap from the api server, to avoid caching all
+	// the ConfigMaps of the cluster for a single object.
+	reader client.Reader
+	key    types.NamespacedName
+}
+
+func NewStore(client client.Client, reader client.Reader, key types.NamespacedName) *Store {
+	return &Store{
+		client: client,
+		reader: reader,
+		key:    key,
+	}
+}
+
+// Load returns the stored checkpoints, it returns no checkpoints if the
+// ConfigMap doesn't exist yet.
+func (s *Store) Load(ctx context.Context) (map[string]Checkpoint, error) {
+	var cm v1.ConfigMap
+	if err := s.reader.Get(ctx, s.key, &cm); err != nil {
+		if apierrors.IsNotFound(err) {
+			return map[string]Checkpoint{}, nil
+		}
+		return nil, fmt.Errorf("failed to get checkpoints configmap: %w", err)
+	}
+
+	checkpoints := make(map[string]Checkpoint, len(cm.Data))
+	for name, value := range cm.Data {
+		var checkpoint Checkpoint
+		if err := json.Unmarshal([]byte(value), &checkpoint); err != nil {
+			return nil, fmt.Errorf("invalid checkpoint %s: %w", name, err)
+		}
+		checkpoints[name] = checkpoint
+	}
+
+	return checkpoints, nil
+}
+
+// Save stores the given checkpoints, replacing the ones stored before.
+func (s *Store) Save(ctx context.Context, checkpoints map[string]Checkpoint) error {
+	data := make(map[string]string, len(checkpoints))
+	for name, checkpoint := range checkpoints {
+		value, err := json.Marshal(checkpoint)
+		if err != nil {
+			return err
+		}
+		data[name] = string(value)
+	}
+
+	var cm v1.ConfigMap
+	if err := s.reader.Get(ctx, s.key, &cm); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to get checkpoints configmap: %w", err)
+		}
+		cm = v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      s.key.Name,
+				Namespace: s.key.Namespace,
+			},
+			Data: data,
+		}
+		if err := s.client.Create(ctx, &cm); err != nil {
+			return fmt.Errorf("failed to create checkpoints configmap: %w", err)
+		}
+		return nil
+	}
+
+	cm.Data = data
+	if err := s.client.Update(ctx, &cm); err != nil {
+		return fmt.Errorf("failed to update checkpoints configmap: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+// Package expression evaluates the CEL expressions filtering the events of
+// the event sets.
+//
+// The expressions are evaluated with the following variables:
+//
+//   - event: the normalized event with the JSON field names of a core/v1
+//     Event, for example event.count or event.source.component
+//   - labels and annotations: the labels and annotations of the event, empty
+//     maps if it has none
+//   - firstTimestamp and lastTimestamp: the times of the first and latest
+//     occurrences of the event
+//   - now: the time the expression is evaluated at
+//
+// For example `event.count > 5 && event.source.component == "kubelet"` or
+// `now - firstTimestamp > duration("1h")`.
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/pkg/events"
+	"github.com/google/cel-go/cel"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// costLimit bounds the cost of an evaluation, so that a single expression
+// can't stall the dispatching of the events.
+const costLimit = 1000000
+
+var env *cel.Env
+
+func init() {
+	var err error
+	env, err = cel.NewEnv(
+		cel.Variable("event", cel.DynType),
+		cel.Variable("labels", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("annotations", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("firstTimestamp", cel.TimestampType),
+		cel.Variable("lastTimestamp", cel.TimestampType),
+		cel.Variable("now", cel.TimestampType),
+	)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create the cel environment: %v", err))
+	}
+}
+
+// Program is a compiled expression.
+type Program struct {
+	program cel.Program
+}
+
+// Compile parses and checks the expression, which must evaluate to a bool.
+func Compile(expr string) (*Program, error) {
+	ast, issues := env.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("expression must evaluate to a bool, got %s", ast.OutputType())
+	}
+
+	program, err := env.Program(ast, cel.CostLimit(costLimit))
+	if err != nil {
+		return nil, err
+	}
+	return &Program{program: program}, nil
+}
+
+// Eval evaluates the expression against the event. Expressions failing to
+// evaluate, for example because they access a field the event doesn't
+// set, return an error.
+func (p *Program) Eval(input *Input) (bool, error) {
+	out, _, err := p.program.Eval(input.vars)
+	if err != nil {
+		return false, err
+	}
+	matched, ok := out.Value().(bool)
+	if !ok {
+		return false, errors.New("expression did not evaluate to a bool")
+	}
+	return matched, nil
+}
+
+// Input holds the variables of an event, they are computed once however
+// many expressions the event is evaluated against.
+type Input struct {
+	vars map[string]interface{}
+}
+
+func NewInput(event *events.Event) *Input {
+	var object map[string]interface{}
+	return &Input{
+		vars: map[string]interface{}{
+			"event": func() interface{} {
+				if object == nil {
+					var err error
+					object, err = runtime.DefaultUnstructuredConverter.ToUnstructured(event)
+					if err != nil {
+						object = map[string]interface{}{}
+					}
+				}
+				return object
+			},
+			"labels":         stringMap(event.Labels),
+			"annotations":    stringMap(event.Annotations),
+			"firstTimestamp": event.FirstTimestamp.Time,
+			"lastTimestamp":  event.LastTimestamp.Time,
+			"now":            time.Now(),
+		},
+	}
+}
+
+func stringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
@@ -0,0 +1,60 @@
+package expression
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/pkg/events"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEval(t *testing.T) {
+	event := &events.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"team": "a"},
+		},
+		Count:          6,
+		Source:         v1.EventSource{Component: "kubelet"},
+		FirstTimestamp: metav1.NewTime(time.Now().Add(-2 * time.Hour)),
+		LastTimestamp:  metav1.NewTime(time.Now().Add(-time.Minute)),
+	}
+
+	tests := []struct {
+		expr    string
+		want    bool
+		evalErr bool
+	}{
+		{expr: `event.count > 5 && event.source.component == "kubelet"`, want: true},
+		{expr: `event.count > 10`, want: false},
+		{expr: `labels["team"] == "a" && !("app" in annotations)`, want: true},
+		{expr: `now - firstTimestamp > duration("1h")`, want: true},
+		{expr: `now - lastTimestamp > duration("1h")`, want: false},
+		{expr: `event.reason == "BackOff"`, evalErr: true},
+		{expr: `has(event.reason) && event.reason == "BackOff"`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			program, err := Compile(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := program.Eval(NewInput(event))
+			if (err != nil) != tt.evalErr {
+				t.Fatalf("unexpected evaluation error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, expr := range []string{`event.count >`, `event.count + 1`, `unknown == 1`} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("expected %q to fail to compile", expr)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	v1alpha1 "github.com/ahsayde/analytics-controller/api/v1alpha1"
+)
+
+const (
+	analyticMetricPrefix = "analytics_"
+	// controllerMetricPrefix is the prefix of the metrics of the
+	// controller, the analytic gauges can't use it.
+	controllerMetricPrefix = "analytics_controller_"
+
+	analyticNameLabel      = "analytic_name"
+	analyticNamespaceLabel = "analytic_namespace"
+)
+
+// Analytics exposes the latest results of the analytics declaring a metric.
+var Analytics = NewAnalyticCollector(metrics.Registry)
+
+func init() {
+	metrics.Registry.MustRegister(Analytics)
+}
+
+type gauge struct {
+	name       string
+	help       string
+	labelNames []string
+	// labelValues values of the analytic labels appended to every sample.
+	labelValues []string
+	samples     []sample
+}
+
+type sample struct {
+	labelValues []string
+	value       float64
+}
+
+// AnalyticCollector is a prometheus collector exposing analytic results as
+// gauges. The gauges are only known after the queries run, so it is an
+// unchecked collector and validates the gauges itself when they are set,
+// an invalid gauge would fail the whole scrape of the registry.
+type AnalyticCollector struct {
+	// registry is the registry the collector is registered with, the
+	// gauges must not clash with its other metrics.
+	registry prometheus.Gatherer
+
+	mu     sync.RWMutex
+	gauges map[types.NamespacedName]gauge
+}
+
+func NewAnalyticCollector(registry prometheus.Gatherer) *AnalyticCollector {
+	return &AnalyticCollector{
+		registry: registry,
+		gauges:   make(map[types.NamespacedName]gauge),
+	}
+}
+
+// Set replaces the gauge samples of an analytic with the given result rows.
+// Rows without a numeric value or with label values which aren't valid
+// UTF-8 are skipped.
+func (c *AnalyticCollector) Set(key types.NamespacedName, metric v1alpha1.AnalyticMetric, rows []map[string]interface{}) error {
+	g := gauge{
+		name:        analyticMetricPrefix + metric.Name,
+		help:        metric.Help,
+		labelNames:  append(append([]string{}, metric.LabelColumns...), analyticNamespaceLabel, analyticNameLabel),
+		labelValues: []string{key.Namespace, key.Name},
+	}
+	if g.help == "" {
+		g.help = fmt.Sprintf("Result of the analytic query %s.", metric.Name)
+	}
+
+	if !model.IsValidMetricName(model.LabelValue(g.name)) {
+		return fmt.Errorf("invalid metric name %s", metric.Name)
+	}
+	if strings.HasPrefix(g.name, controllerMetricPrefix) {
+		return fmt.Errorf("metric name %s is reserved for the controller metrics", metric.Name)
+	}
+	for _, name := range metric.LabelColumns {
+		if !model.LabelName(name).IsValid() || name == analyticNameLabel || name == analyticNamespaceLabel {
+			return fmt.Errorf("invalid label column %s", name)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		value, ok := toFloat(row[metric.ValueColumn])
+		if !ok {
+			continue
+		}
+
+		labelValues := make([]string, 0, len(metric.LabelColumns))
+		for _, column := range metric.LabelColumns {
+			labelValues = append(labelValues, toString(row[column]))
+		}
+		if !validLabelValues(labelValues) {
+			continue
+		}
+
+		id := fmt.Sprintf("%q", labelValues)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		g.samples = append(g.samples, sample{labelValues: labelValues, value: value})
+	}
+
+	// gathered before locking, the registry collects the gauges.
+	families, _ := c.registry.Gather()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	gauges := make(map[string]bool, len(c.gauges))
+	for _, existing := range c.gauges {
+		gauges[existing.name] = true
+	}
+	for _, family := range families {
+		if !gauges[family.GetName()] && clashes(g.name, family) {
+			return fmt.Errorf("metric %s clashes with the controller metric %s", metric.Name, family.GetName())
+		}
+	}
+
+	for other, existing := range c.gauges {
+		if other == key || existing.name != g.name {
+			continue
+		}
+		if existing.help != g.help || fmt.Sprint(existing.labelNames) != fmt.Sprint(g.labelNames) {
+			return fmt.Errorf("metric %s is already exposed by analytic %s with different help or labels", metric.Name, other)
+		}
+	}
+
+	c.gauges[key] = g
+
+	return nil
+}
+
+// Delete removes the gauge samples of an analytic.
+func (c *AnalyticCollector) Delete(key types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.gauges, key)
+}
+
+// Describe sends no descriptors which makes the collector unchecked.
+func (c *AnalyticCollector) Describe(_ chan<- *prometheus.Desc) {}
+
+func (c *AnalyticCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, g := range c.gauges {
+		desc := prometheus.NewDesc(g.name, g.help, g.labelNames, nil)
+		for _, s := range g.samples {
+			labelValues := append(append([]string{}, s.labelValues...), g.labelValues...)
+			metric, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, s.value, labelValues...)
+			if err != nil {
+				// skipped rather than failing the scrape of every metric
+				continue
+			}
+			ch <- metric
+		}
+	}
+}
+
+// clashes reports whether the gauge name is the name of the family or of
+// the series of its histograms or summaries.
+func clashes(name string, family *dto.MetricFamily) bool {
+	if name == family.GetName() {
+		return true
+	}
+	switch family.GetType() {
+	case dto.MetricType_HISTOGRAM, dto.MetricType_SUMMARY:
+		for _, suffix := range []string{"_count", "_sum", "_bucket"} {
+			if name == family.GetName()+suffix {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func validLabelValues(values []string) bool {
+	for _, value := range values {
+		if !utf8.ValidString(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toString(value interface{}) string {
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+
+	v1alpha1 "github.com/ahsayde/analytics-controller/api/v1alpha1"
+)
+
+func TestAnalyticCollectorSkipsInvalidLabelValues(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	collector := NewAnalyticCollector(registry)
+	registry.MustRegister(collector)
+
+	metric := v1alpha1.AnalyticMetric{Name: "events", ValueColumn: "count", LabelColumns: []string{"reason"}}
+	rows := []map[string]interface{}{
+		{"count": int64(1), "reason": "BackOff"},
+		{"count": int64(2), "reason": "\xff"},
+	}
+	key := types.NamespacedName{Namespace: "default", Name: "events"}
+	if err := collector.Set(key, metric, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gather failed: %s", err)
+	}
+	if len(families) != 1 || len(families[0].GetMetric()) != 1 {
+		t.Fatalf("got %v, want a single sample", families)
+	}
+}
+
+func TestAnalyticCollectorRejectsClashingNames(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	collector := NewAnalyticCollector(registry)
+	registry.MustRegister(collector)
+
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "analytics_events_total"})
+	histogram := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "analytics_duration_seconds"})
+	registry.MustRegister(counter, histogram)
+
+	rows := []map[string]interface{}{{"count": int64(1)}}
+	key := types.NamespacedName{Namespace: "default", Name: "events"}
+	for _, name := range []string{"events_total", "duration_seconds_count", "controller_sink_written_events_total"} {
+		metric := v1alpha1.AnalyticMetric{Name: name, ValueColumn: "count"}
+		if err := collector.Set(key, metric, rows); err == nil {
+			t.Errorf("metric %s was accepted", name)
+		}
+	}
+
+	// the gauges of the collector are replaced and shared by the analytics
+	metric := v1alpha1.AnalyticMetric{Name: "events", ValueColumn: "count"}
+	for i := 0; i < 2; i++ {
+		if err := collector.Set(key, metric, rows); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := collector.Set(types.NamespacedName{Namespace: "default", Name: "other"}, metric, rows); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.Gather(); err != nil {
+		t.Fatalf("gather failed: %s", err)
+	}
+}
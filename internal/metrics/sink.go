@@ -0,0 +1,201 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	sinkLabel     = "sink"
+	eventSetLabel = "eventset"
+	kindLabel     = "kind"
+	codeLabel     = "code"
+)
+
+var (
+	// WatcherEvents counts the event notifications received by the watcher.
+	WatcherEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "analytics_controller_watcher_events_received_total",
+			Help: "Number of event notifications received by the watcher by kind of change.",
+		},
+		[]string{kindLabel},
+	)
+
+	// EventSetMatchedEvents counts the events matched by each event set.
+	EventSetMatchedEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "analytics_controller_eventset_matched_events_total",
+			Help: "Number of events matched by each event set.",
+		},
+		[]string{eventSetLabel},
+	)
+
+	// SinkDroppedEvents counts the events dropped by the sink queues.
+	SinkDroppedEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "analytics_controller_sink_dropped_events_total",
+			Help: "Number of events dropped because the sink queue was full.",
+		},
+		[]string{sinkLabel},
+	)
+
+	sinkWrittenEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "analytics_controller_sink_written_events_total",
+			Help: "Number of events written by each sink.",
+		},
+		[]string{sinkLabel},
+	)
+
+	sinkFailedEvents = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "analytics_controller_sink_failed_events_total",
+			Help: "Number of events each sink failed to write after exhausting their retries.",
+		},
+		[]string{sinkLabel},
+	)
+
+	sinkQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "analytics_controller_sink_queue_depth",
+			Help: "Number of events waiting in each sink queue.",
+		},
+		[]string{sinkLabel},
+	)
+
+	elasticBatchSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "analytics_controller_elastic_batch_size",
+			Help:    "Number of events in the bulk requests of each elastic sink.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+		},
+		[]string{sinkLabel},
+	)
+
+	elasticFlushDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "analytics_controller_elastic_flush_duration_seconds",
+			Help:    "Duration of the bulk requests of each elastic sink.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{sinkLabel},
+	)
+
+	webhookResponses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "analytics_controller_webhook_responses_total",
+			Help: "Number of webhook responses by sink and status code.",
+		},
+		[]string{sinkLabel, codeLabel},
+	)
+)
+
+// webhookCodes are the status codes recorded for each sink, so that their
+// series can be deleted with the sink.
+var webhookCodes = struct {
+	sync.Mutex
+	codes map[string]map[string]struct{}
+}{codes: make(map[string]map[string]struct{})}
+
+func init() {
+	metrics.Registry.MustRegister(
+		WatcherEvents,
+		EventSetMatchedEvents,
+		SinkDroppedEvents,
+		sinkWrittenEvents,
+		sinkFailedEvents,
+		sinkQueueDepth,
+		elasticBatchSize,
+		elasticFlushDuration,
+		webhookResponses,
+	)
+}
+
+// SinkMetrics records the metrics of a sink, its methods do nothing when
+// called on a nil SinkMetrics.
+type SinkMetrics struct {
+	name    string
+	written prometheus.Counter
+	failed  prometheus.Counter
+}
+
+func ForSink(name string) *SinkMetrics {
+	return &SinkMetrics{
+		name:    name,
+		written: sinkWrittenEvents.WithLabelValues(name),
+		failed:  sinkFailedEvents.WithLabelValues(name),
+	}
+}
+
+func (m *SinkMetrics) Written(count int) {
+	if m == nil {
+		return
+	}
+	m.written.Add(float64(count))
+}
+
+func (m *SinkMetrics) Failed(count int) {
+	if m == nil {
+		return
+	}
+	m.failed.Add(float64(count))
+}
+
+func (m *SinkMetrics) QueueDepth(depth int) {
+	if m == nil {
+		return
+	}
+	sinkQueueDepth.WithLabelValues(m.name).Set(float64(depth))
+}
+
+// Flushed records an elastic bulk request.
+func (m *SinkMetrics) Flushed(size int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	elasticBatchSize.WithLabelValues(m.name).Observe(float64(size))
+	elasticFlushDuration.WithLabelValues(m.name).Observe(duration.Seconds())
+}
+
+func (m *SinkMetrics) WebhookResponse(statusCode int) {
+	if m == nil {
+		return
+	}
+	code := strconv.Itoa(statusCode)
+	webhookResponses.WithLabelValues(m.name, code).Inc()
+
+	webhookCodes.Lock()
+	defer webhookCodes.Unlock()
+	if webhookCodes.codes[m.name] == nil {
+		webhookCodes.codes[m.name] = make(map[string]struct{})
+	}
+	webhookCodes.codes[m.name][code] = struct{}{}
+}
+
+// DeleteSink removes the metrics of a sink.
+func DeleteSink(name string) {
+	labels := prometheus.Labels{sinkLabel: name}
+	SinkDroppedEvents.Delete(labels)
+	sinkWrittenEvents.Delete(labels)
+	sinkFailedEvents.Delete(labels)
+	sinkQueueDepth.Delete(labels)
+	elasticBatchSize.Delete(labels)
+	elasticFlushDuration.Delete(labels)
+
+	webhookCodes.Lock()
+	defer webhookCodes.Unlock()
+	for code := range webhookCodes.codes[name] {
+		webhookResponses.Delete(prometheus.Labels{sinkLabel: name, codeLabel: code})
+	}
+	delete(webhookCodes.codes, name)
+}
+
+// DeleteEventSet removes the metrics of an event set.
+func DeleteEventSet(name string) {
+	EventSetMatchedEvents.Delete(prometheus.Labels{eventSetLabel: name})
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/api/v1alpha1"
+	"github.com/ahsayde/analytics-controller/internal/sinks"
+	"github.com/ahsayde/analytics-controller/internal/watcher"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/certwatcher"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+const (
+	queryPathPrefix = "/api/v1alpha1/"
+	querySuffix     = "query"
+
+	certName = "tls.crt"
+	keyName  = "tls.key"
+
+	maxRequestBodySize = 1 << 20
+	shutdownTimeout    = 10 * time.Second
+)
+
+// QueryRequest is the body of a query request.
+type QueryRequest struct {
+	// Query to run against the events stored in the sink.
+	Query string `json:"query"`
+	// Args values bound to the query parameters.
+	Args []interface{} `json:"args,omitempty"`
+	// Window restricts the query to events with a lastTimestamp within
+	// the window before the request time, for example 1h.
+	Window *metav1.Duration `json:"window,omitempty"`
+	// Limit maximum number of rows to return.
+	Limit int `json:"limit,omitempty"`
+	// Timeout of the query, for example 30s.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// QueryServer serves read only queries over the events stored in the
+// registered sinks at POST /api/v1alpha1/sinks/{name}/query and
+// /api/v1alpha1/namespaces/{namespace}/namespacedsinks/{name}/query.
+// Requests must bear the token of a user allowed to create the query
+// subresource of the sink, sinks/query or namespacedsinks/query, so they
+// are only served over TLS with the tls.crt and tls.key certificate of the
+// cert directory, reloaded when they change.
+type QueryServer struct {
+	addr    string
+	certDir string
+	watcher *watcher.Watcher
+	client  client.Client
+}
+
+func NewQueryServer(addr, certDir string, watcher *watcher.Watcher, client client.Client) *QueryServer {
+	return &QueryServer{
+		addr:    addr,
+		certDir: certDir,
+		watcher: watcher,
+		client:  client,
+	}
+}
+
+// NeedLeaderElection only serves queries on the leader, the sinks are
+// registered by its reconcilers and not on the other replicas.
+func (s *QueryServer) NeedLeaderElection() bool {
+	return true
+}
+
+func (s *QueryServer) Start(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(queryPathPrefix, s.handleQuery)
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      sinks.MaxQueryTimeout + 10*time.Second,
+	}
+
+	certWatcher, err := certwatcher.New(filepath.Join(s.certDir, certName), filepath.Join(s.certDir, keyName))
+	if err != nil {
+		return fmt.Errorf("failed to load the query server certificate: %w", err)
+	}
+	go func() {
+		if err := certWatcher.Start(ctx); err != nil {
+			log.Log.Error(err, "failed to watch the query server certificate")
+		}
+	}()
+
+	listener, err := tls.Listen("tcp", s.addr, &tls.Config{
+		GetCertificate: certWatcher.GetCertificate,
+		MinVersion:     tls.VersionTLS12,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+
+	log.Log.Info("starting query server", "address", listener.Addr().String(), "certDir", s.certDir)
+
+	errChan := make(chan error, 1)
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errChan <- err
+		}
+		close(errChan)
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
+}
+
+func (s *QueryServer) handleQuery(w http.ResponseWriter, r *http.Request) {
+	key, attrs, ok := parseQueryPath(r.URL.Path)
+	if !ok {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if status, err := s.authorize(r, attrs); err != nil {
+		writeError(w, status, err.Error())
+		return
+	}
+
+	var req QueryRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %s", err))
+		return
+	}
+	if req.Query == "" {
+		writeError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+
+	sink, err := s.watcher.QueryableSink(key)
+	if errors.Is(err, watcher.ErrSinkNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	opts := sinks.QueryOptions{
+		Args:  req.Args,
+		Limit: req.Limit,
+	}
+	if req.Window != nil {
+		opts.Since = time.Now().Add(-req.Window.Duration)
+	}
+	if req.Timeout != nil {
+		opts.Timeout = req.Timeout.Duration
+	}
+
+	result, err := sink.Query(r.Context(), req.Query, opts)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// parseQueryPath returns the watcher key of the sink queried at the path
+// and the attributes the query is authorized with, ok is false if the path
+// isn't a query path.
+func parseQueryPath(path string) (key string, attrs authorizationv1.ResourceAttributes, ok bool) {
+	parts := strings.Split(strings.TrimPrefix(path, queryPathPrefix), "/")
+	for _, part := range parts {
+		if part == "" {
+			return "", attrs, false
+		}
+	}
+
+	attrs = authorizationv1.ResourceAttributes{
+		Verb:        "create",
+		Group:       v1alpha1.GroupVersion.Group,
+		Version:     v1alpha1.GroupVersion.Version,
+		Subresource: querySuffix,
+	}
+	switch {
+	case len(parts) == 3 && parts[0] == "sinks" && parts[2] == querySuffix:
+		attrs.Resource = "sinks"
+		attrs.Name = parts[1]
+		return parts[1], attrs, true
+	case len(parts) == 5 && parts[0] == "namespaces" && parts[2] == "namespacedsinks" && parts[4] == querySuffix:
+		attrs.Resource = "namespacedsinks"
+		attrs.Namespace = parts[1]
+		attrs.Name = parts[3]
+		return watcher.Key(parts[1], parts[3]), attrs, true
+	}
+	return "", attrs, false
+}
+
+// authorize authenticates the bearer token of the request and checks that
+// its user is allowed to query the sink, the returned status is the one
+// the request fails with.
+func (s *QueryServer) authorize(r *http.Request, attrs authorizationv1.ResourceAttributes) (int, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		return http.StatusUnauthorized, errors.New("bearer token is required")
+	}
+
+	tokenReview := authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}
+	if err := s.client.Create(r.Context(), &tokenReview); err != nil {
+		log.Log.Error(err, "failed to review token")
+		return http.StatusInternalServerError, errors.New("failed to authenticate the request")
+	}
+	if !tokenReview.Status.Authenticated {
+		return http.StatusUnauthorized, errors.New("invalid bearer token")
+	}
+
+	user := tokenReview.Status.User
+	review := authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &attrs,
+			User:               user.Username,
+			Groups:             user.Groups,
+			UID:                user.UID,
+			Extra:              make(map[string]authorizationv1.ExtraValue, len(user.Extra)),
+		},
+	}
+	for key, value := range user.Extra {
+		review.Spec.Extra[key] = authorizationv1.ExtraValue(value)
+	}
+	if err := s.client.Create(r.Context(), &review); err != nil {
+		log.Log.Error(err, "failed to review access")
+		return http.StatusInternalServerError, errors.New("failed to authorize the request")
+	}
+	if !review.Status.Allowed {
+		return http.StatusForbidden, fmt.Errorf("user %s is not allowed to query %s %s", user.Username, attrs.Resource, attrs.Name)
+	}
+	return http.StatusOK, nil
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Log.Error(err, "failed to write query response")
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/ahsayde/analytics-controller/api/v1alpha1"
+	"github.com/ahsayde/analytics-controller/internal/watcher"
+)
+
+const testToken = "token"
+
+// reviewingClient authenticates testToken as the user alice, who is
+// allowed to query the sinks named in allowed.
+type reviewingClient struct {
+	client.Client
+	allowed map[string]bool
+	reviews []authorizationv1.ResourceAttributes
+}
+
+func (c *reviewingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	switch review := obj.(type) {
+	case *authenticationv1.TokenReview:
+		if review.Spec.Token == testToken {
+			review.Status.Authenticated = true
+			review.Status.User = authenticationv1.UserInfo{Username: "alice"}
+		}
+		return nil
+	case *authorizationv1.SubjectAccessReview:
+		attrs := *review.Spec.ResourceAttributes
+		c.reviews = append(c.reviews, attrs)
+		review.Status.Allowed = review.Spec.User == "alice" && c.allowed[watcher.Key(attrs.Namespace, attrs.Name)]
+		return nil
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func newTestServer(t *testing.T, allowed ...string) (*QueryServer, *reviewingClient) {
+	w := watcher.New(nil, watcher.Options{})
+	sink := v1alpha1.Sink{
+		ObjectMeta: metav1.ObjectMeta{Name: "events"},
+		Spec: v1alpha1.SinkSpec{
+			SQLite: &v1alpha1.SqliteSink{Path: filepath.Join(t.TempDir(), "events.db")},
+		},
+	}
+	if err := w.RegisterSink(context.Background(), sink, nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.RemoveSink("events") })
+
+	c := &reviewingClient{
+		Client:  fake.NewClientBuilder().Build(),
+		allowed: make(map[string]bool),
+	}
+	for _, key := range allowed {
+		c.allowed[key] = true
+	}
+	return NewQueryServer("", "", w, c), c
+}
+
+func query(s *QueryServer, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.handleQuery(rec, req)
+	return rec
+}
+
+func TestHandleQuery(t *testing.T) {
+	const body = `{"query": "SELECT count(*) AS count FROM events"}`
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{name: "not a query path", method: http.MethodPost, path: "/api/v1alpha1/sinks/events", token: testToken, want: http.StatusNotFound},
+		{name: "empty path segment", method: http.MethodPost, path: "/api/v1alpha1/sinks//query", token: testToken, want: http.StatusNotFound},
+		{name: "not a post", method: http.MethodGet, path: "/api/v1alpha1/sinks/events/query", token: testToken, want: http.StatusMethodNotAllowed},
+		{name: "no token", method: http.MethodPost, path: "/api/v1alpha1/sinks/events/query", want: http.StatusUnauthorized},
+		{name: "invalid token", method: http.MethodPost, path: "/api/v1alpha1/sinks/events/query", token: "invalid", want: http.StatusUnauthorized},
+		{name: "forbidden", method: http.MethodPost, path: "/api/v1alpha1/sinks/other/query", token: testToken, want: http.StatusForbidden},
+		{name: "allowed", method: http.MethodPost, path: "/api/v1alpha1/sinks/events/query", token: testToken, want: http.StatusOK},
+		{name: "sink not found", method: http.MethodPost, path: "/api/v1alpha1/sinks/missing/query", token: testToken, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t, "events", "missing")
+			rec := query(s, tt.method, tt.path, tt.token, body)
+			if rec.Code != tt.want {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleQueryRoutesNamespacedSinks(t *testing.T) {
+	s, c := newTestServer(t, "team-a/events")
+
+	// the namespaced sink isn't registered, the cluster sink of the same
+	// name is never queried through the namespaced path.
+	rec := query(s, http.MethodPost, "/api/v1alpha1/namespaces/team-a/namespacedsinks/events/query", testToken, `{"query": "SELECT 1"}`)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusNotFound, rec.Body.String())
+	}
+	var resp errorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(resp.Error, "team-a/events") {
+		t.Errorf("got error %q, want the namespaced sink key", resp.Error)
+	}
+
+	if len(c.reviews) != 1 {
+		t.Fatalf("got %d access reviews, want 1", len(c.reviews))
+	}
+	if attrs := c.reviews[0]; attrs.Resource != "namespacedsinks" || attrs.Namespace != "team-a" || attrs.Name != "events" {
+		t.Errorf("reviewed attributes %+v", attrs)
+	}
+
+	// allowed on the namespaced sink only
+	rec = query(s, http.MethodPost, "/api/v1alpha1/sinks/events/query", testToken, `{"query": "SELECT 1"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body.String())
+	}
+}
+
+func TestParseQueryPath(t *testing.T) {
+	tests := []struct {
+		path      string
+		key       string
+		resource  string
+		namespace string
+		ok        bool
+	}{
+		{path: "/api/v1alpha1/sinks/events/query", key: "events", resource: "sinks", ok: true},
+		{path: "/api/v1alpha1/namespaces/team-a/namespacedsinks/events/query", key: "team-a/events", resource: "namespacedsinks", namespace: "team-a", ok: true},
+		{path: "/api/v1alpha1/sinks/events/query/"},
+		{path: "/api/v1alpha1/sinks/events"},
+		{path: "/api/v1alpha1/namespaces/team-a/sinks/events/query"},
+		{path: "/api/v1alpha1/namespaces//namespacedsinks/events/query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			key, attrs, ok := parseQueryPath(tt.path)
+			if ok != tt.ok {
+				t.Fatalf("got ok %t, want %t", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if key != tt.key || attrs.Resource != tt.resource || attrs.Namespace != tt.namespace || attrs.Subresource != "query" || attrs.Verb != "create" {
+				t.Errorf("got key %s and attributes %+v", key, attrs)
+			}
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package sinks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/internal/metrics"
+	"github.com/ahsayde/analytics-controller/pkg/events"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	DefaultRetries          = 5
+	DefaultRetryInterval    = 500 * time.Millisecond
+	DefaultMaxRetryInterval = 30 * time.Second
+
+	// retryJitter spreads the retries of the sinks failing at the same time.
+	retryJitter = 0.2
+)
+
+// DeadLetter receives the events that failed to be delivered.
+type DeadLetter interface {
+	WriteDeadLetter(ctx context.Context, event events.Event, err error) error
+	Close() error
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error as not worth retrying.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+// Retryable reports whether a request failing with the given HTTP status
+// code may succeed if retried.
+func Retryable(statusCode int) bool {
+	if statusCode >= http.StatusInternalServerError {
+		return true
+	}
+	return statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests
+}
+
+type DelivererOptions struct {
+	// Retries number of times a failed send is retried.
+	Retries int
+	// RetryInterval wait before the first retry, defaults to
+	// DefaultRetryInterval.
+	RetryInterval time.Duration
+	// MaxRetryInterval maximum wait between retries, defaults to
+	// DefaultMaxRetryInterval.
+	MaxRetryInterval time.Duration
+	// DeadLetter receives the events exhausting their retries, they are
+	// dropped if nil.
+	DeadLetter DeadLetter
+	// FailureThreshold number of consecutive failed sends opening the
+	// circuit breaker, defaults to DefaultFailureThreshold.
+	FailureThreshold int
+	// OpenDuration how long the circuit breaker stays open, defaults to
+	// DefaultOpenDuration.
+	OpenDuration time.Duration
+	// Metrics records the written and failed events.
+	Metrics *metrics.SinkMetrics
+}
+
+// Deliverer retries the failed sends of a sink with a jittered exponential
+// backoff and hands the events exhausting their retries to the dead-letter
+// target. While its circuit breaker is open the sends wait for it to let a
+// probe through, holding the events in the queue of the sink, and only fail
+// right away once the sink is stopping.
+type Deliverer struct {
+	opts    DelivererOptions
+	breaker *Breaker
+
+	stopping chan struct{}
+	stopOnce sync.Once
+}
+
+func NewDeliverer(opts DelivererOptions) *Deliverer {
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = DefaultRetryInterval
+	}
+	if opts.MaxRetryInterval <= 0 {
+		opts.MaxRetryInterval = DefaultMaxRetryInterval
+	}
+	return &Deliverer{
+		opts:     opts,
+		breaker:  NewBreaker(opts.FailureThreshold, opts.OpenDuration),
+		stopping: make(chan struct{}),
+	}
+}
+
+// Deliver calls send until it succeeds, the retries are exhausted, the error
+// is permanent or the context is done. The failures while the circuit
+// breaker is open don't count as retries, the events are held until the
+// backend recovers or the sink stops. An error is returned if the events
+// were neither delivered nor written to the dead-letter target.
+func (d *Deliverer) Deliver(ctx context.Context, batch []events.Event, send func(ctx context.Context) error) error {
+	backoff := wait.Backoff{
+		Duration: d.opts.RetryInterval,
+		Factor:   2,
+		Jitter:   retryJitter,
+		Steps:    d.opts.Retries,
+		Cap:      d.opts.MaxRetryInterval,
+	}
+
+	var err error
+	retries := 0
+	for {
+		if err = d.breaker.Wait(ctx, d.stopping); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			break
+		}
+		err = send(ctx)
+		d.breaker.Record(err)
+		if err == nil {
+			d.opts.Metrics.Written(len(batch))
+			return nil
+		}
+		if IsPermanent(err) {
+			break
+		}
+		if d.breaker.Health().CircuitOpen {
+			// waits for the next probe
+			continue
+		}
+		if retries >= d.opts.Retries {
+			break
+		}
+		retries++
+
+		timer := time.NewTimer(backoff.Step())
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+
+	d.opts.Metrics.Failed(len(batch))
+	if d.opts.DeadLetter == nil {
+		return err
+	}
+	for _, event := range batch {
+		if dlErr := d.opts.DeadLetter.WriteDeadLetter(ctx, event, err); dlErr != nil {
+			return fmt.Errorf("%w, failed to write dead letter: %v", err, dlErr)
+		}
+	}
+	log.Log.Error(err, "events exhausted their retries and were written to the dead-letter target", "count", len(batch))
+	return nil
+}
+
+// Metrics returns the metrics of the sink, nil if it has none.
+func (d *Deliverer) Metrics() *metrics.SinkMetrics {
+	return d.opts.Metrics
+}
+
+// Health returns the delivery health of the sink.
+func (d *Deliverer) Health() Health {
+	return d.breaker.Health()
+}
+
+// Stop stops holding the events while the circuit breaker is open, so that
+// a stopping sink doesn't wait for its backend to recover to drain its
+// queue.
+func (d *Deliverer) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stopping)
+	})
+}
+
+// Close closes the dead-letter target.
+func (d *Deliverer) Close() error {
+	if d.opts.DeadLetter == nil {
+		return nil
+	}
+	return d.opts.DeadLetter.Close()
+}
+
+type deadLetterRecord struct {
+	Time  time.Time    `json:"time"`
+	Error string       `json:"error"`
+	Event events.Event `json:"event"`
+}
+
+// FileDeadLetter appends the events that failed to be delivered to a file,
+// one JSON record per line.
+type FileDeadLetter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileDeadLetter(path string) (*FileDeadLetter, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead-letter file %s : %w", path, err)
+	}
+	return &FileDeadLetter{file: file}, nil
+}
+
+func (f *FileDeadLetter) WriteDeadLetter(_ context.Context, event events.Event, err error) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return json.NewEncoder(f.file).Encode(deadLetterRecord{
+		Time:  time.Now().UTC(),
+		Error: err.Error(),
+		Event: event,
+	})
+}
+
+func (f *FileDeadLetter) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
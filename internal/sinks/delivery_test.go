@@ -0,0 +1,111 @@
+package sinks
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/pkg/events"
+)
+
+type recordingDeadLetter struct {
+	letters []events.Event
+}
+
+func (r *recordingDeadLetter) WriteDeadLetter(_ context.Context, event events.Event, _ error) error {
+	r.letters = append(r.letters, event)
+	return nil
+}
+
+func (r *recordingDeadLetter) Close() error {
+	return nil
+}
+
+func TestDeliverRetries(t *testing.T) {
+	errUnavailable := errors.New("service unavailable")
+	tests := []struct {
+		name        string
+		failures    int
+		err         error
+		wantCalls   int
+		wantDead    int
+		wantErr     bool
+		deadLetters bool
+	}{
+		{name: "succeeds after retries", failures: 2, err: errUnavailable, wantCalls: 3},
+		{name: "dead-letters after exhausting retries", failures: 10, err: errUnavailable, wantCalls: 4, wantDead: 1, deadLetters: true},
+		{name: "fails without dead-letter target", failures: 10, err: errUnavailable, wantCalls: 4, wantErr: true},
+		{name: "does not retry permanent errors", failures: 10, err: Permanent(errUnavailable), wantCalls: 1, wantDead: 1, deadLetters: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deadLetter := &recordingDeadLetter{}
+			opts := DelivererOptions{
+				Retries:       3,
+				RetryInterval: time.Millisecond,
+			}
+			if tt.deadLetters {
+				opts.DeadLetter = deadLetter
+			}
+			deliverer := NewDeliverer(opts)
+
+			calls := 0
+			err := deliverer.Deliver(context.Background(), []events.Event{{}}, func(context.Context) error {
+				calls++
+				if calls <= tt.failures {
+					return tt.err
+				}
+				return nil
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if calls != tt.wantCalls {
+				t.Fatalf("expected %d calls, got %d", tt.wantCalls, calls)
+			}
+			if len(deadLetter.letters) != tt.wantDead {
+				t.Fatalf("expected %d dead letters, got %d", tt.wantDead, len(deadLetter.letters))
+			}
+		})
+	}
+}
+
+func TestDeliverHoldsEventsWhileCircuitIsOpen(t *testing.T) {
+	deadLetter := &recordingDeadLetter{}
+	deliverer := NewDeliverer(DelivererOptions{
+		Retries:          1,
+		RetryInterval:    time.Millisecond,
+		FailureThreshold: 1,
+		OpenDuration:     10 * time.Millisecond,
+		DeadLetter:       deadLetter,
+	})
+
+	calls := 0
+	err := deliverer.Deliver(context.Background(), []events.Event{{}}, func(context.Context) error {
+		calls++
+		if calls <= 3 {
+			return errors.New("service unavailable")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("expected the events to be delivered once the backend recovered, got %v", err)
+	}
+	if calls != 4 || len(deadLetter.letters) != 0 {
+		t.Fatalf("expected 4 calls and no dead letters, got %d calls and %d dead letters", calls, len(deadLetter.letters))
+	}
+
+	// a stopping sink doesn't wait for its backend
+	deliverer.breaker.Record(errors.New("service unavailable"))
+	deliverer.Stop()
+	err = deliverer.Deliver(context.Background(), []events.Event{{}}, func(context.Context) error {
+		t.Error("expected no send while the circuit is open")
+		return nil
+	})
+	if err != nil || len(deadLetter.letters) != 1 {
+		t.Fatalf("expected the events to be dead-lettered, got %v and %d dead letters", err, len(deadLetter.letters))
+	}
+}
@@ -5,22 +5,21 @@ import (
 	"context"
 	_ "embed"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
 	"time"
 
+	"github.com/ahsayde/analytics-controller/internal/sinks"
+	"github.com/ahsayde/analytics-controller/internal/sinks/queue"
+	"github.com/ahsayde/analytics-controller/pkg/events"
 	elastic "github.com/elastic/go-elasticsearch/v7"
 	"github.com/elastic/go-elasticsearch/v7/esapi"
-	v1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-const (
-	resultChanSize  int           = 50
-	retriesInterval time.Duration = 500 * time.Millisecond
-	retries         int           = 5
-)
-
 //go:embed schema.json
 var schema []byte
 
@@ -33,16 +32,32 @@ type Index struct {
 	Id        string `json:"_id"`
 }
 
+type sqlRequest struct {
+	Query          string                 `json:"query"`
+	Params         []interface{}          `json:"params,omitempty"`
+	Filter         map[string]interface{} `json:"filter,omitempty"`
+	FetchSize      int                    `json:"fetch_size"`
+	RequestTimeout string                 `json:"request_timeout"`
+}
+
+type sqlResponse struct {
+	Columns []sinks.Column  `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+	Cursor  string          `json:"cursor"`
+}
+
 type ElasticSink struct {
 	client      *elastic.Client
 	indexName   string
-	eventBatch  []v1.Event
-	eventChan   chan v1.Event
+	batch       []queue.Item
+	queue       queue.Queue
+	deliverer   *sinks.Deliverer
+	done        chan struct{}
 	batchExpiry time.Duration
 }
 
 // New returns a sink that sends results to elasticsearch index
-func New(address, index, username, password string, batchSize, batchExpriry int) (*ElasticSink, error) {
+func New(address, index, username, password string, batchSize, batchExpriry int, q queue.Queue, deliverer *sinks.Deliverer) (*ElasticSink, error) {
 	client, err := elastic.NewClient(
 		elastic.Config{
 			Addresses: []string{address},
@@ -55,61 +70,134 @@ func New(address, index, username, password string, batchSize, batchExpriry int)
 	}
 
 	return &ElasticSink{
-		eventChan:   make(chan v1.Event, resultChanSize),
-		eventBatch:  make([]v1.Event, 0, batchSize),
+		queue:       q,
+		deliverer:   deliverer,
+		done:        make(chan struct{}),
+		batch:       make([]queue.Item, 0, batchSize),
 		client:      client,
 		indexName:   index,
 		batchExpiry: time.Duration(batchExpriry * int(time.Second)),
 	}, nil
 }
 
-func (es *ElasticSink) Write(_ context.Context, event v1.Event) error {
-	es.eventChan <- event
+func (es *ElasticSink) Write(ctx context.Context, event events.Event) error {
+	return es.queue.Push(ctx, event)
+}
+
+// Probe pings the cluster and checks that the index is accessible, it is
+// created on the first write if it doesn't exist.
+func (es *ElasticSink) Probe(ctx context.Context) error {
+	ping, err := es.client.Ping(es.client.Ping.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to reach elasticsearch: %w", err)
+	}
+	ping.Body.Close()
+	if ping.IsError() {
+		return fmt.Errorf("elasticsearch ping failed with status: %s", ping.Status())
+	}
+
+	req := esapi.IndicesExistsRequest{Index: []string{es.indexName}}
+	resp, err := req.Do(ctx, es.client)
+	if err != nil {
+		return fmt.Errorf("failed to check index %s: %w", es.indexName, err)
+	}
+	resp.Body.Close()
+	if resp.IsError() && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to check index %s, status: %s", es.indexName, resp.Status())
+	}
 	return nil
 }
 
+// Health returns the delivery health of the sink.
+func (es *ElasticSink) Health() sinks.Health {
+	return es.deliverer.Health()
+}
+
 // Start starts the sink to send events when batch size is met or an interval has passed
 func (es *ElasticSink) Start(ctx context.Context) error {
 	go es.worker(ctx)
 	return nil
 }
 
+// Stop closes the queue and waits for the events left in memory to be
+// written.
 func (es *ElasticSink) Stop() error {
-	close(es.eventChan)
+	if err := es.queue.Close(); err != nil {
+		log.Log.Error(err, "failed to close queue")
+	}
+	es.deliverer.Stop()
+	<-es.done
+	if err := es.deliverer.Close(); err != nil {
+		log.Log.Error(err, "failed to close dead-letter target")
+	}
 	return nil
 }
 
-func (es *ElasticSink) worker(ctx context.Context) error {
-	timer := time.NewTicker(es.batchExpiry)
+func (es *ElasticSink) worker(ctx context.Context) {
+	defer close(es.done)
+	flushAt := time.Now().Add(es.batchExpiry)
 	for {
-		select {
-		case result := <-es.eventChan:
-			es.eventBatch = append(es.eventBatch, result)
-			if len(es.eventBatch) == cap(es.eventBatch) {
-				es.writeBatch(ctx, es.eventBatch)
-				es.eventBatch = es.eventBatch[:0]
-				timer.Reset(es.batchExpiry)
-			}
-		case <-timer.C:
-			if len(es.eventBatch) > 0 {
-				es.writeBatch(ctx, es.eventBatch)
-				es.eventBatch = es.eventBatch[:0]
+		popCtx, cancel := context.WithDeadline(ctx, flushAt)
+		item, err := es.queue.Pop(popCtx)
+		cancel()
+		switch {
+		case err == nil:
+			es.batch = append(es.batch, item)
+			if len(es.batch) < cap(es.batch) {
+				continue
 			}
-		case <-ctx.Done():
-			if len(es.eventBatch) > 0 {
-				es.writeBatch(ctx, es.eventBatch)
-			}
-			return ctx.Err()
+		case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+		default:
+			es.flush(ctx)
+			return
 		}
+		es.flush(ctx)
+		flushAt = time.Now().Add(es.batchExpiry)
 	}
 }
 
-func (es *ElasticSink) writeBatch(ctx context.Context, events []v1.Event) {
-	body, err := es.createBody(events)
+// flush writes the batch and acknowledges its events, or requeues them if
+// the write failed.
+func (es *ElasticSink) flush(ctx context.Context) {
+	if len(es.batch) == 0 {
+		return
+	}
+	defer func() {
+		es.batch = es.batch[:0]
+	}()
+
+	docs := make([]events.Event, 0, len(es.batch))
+	for _, item := range es.batch {
+		docs = append(docs, item.Event)
+	}
+
+	err := es.deliverer.Deliver(ctx, docs, func(ctx context.Context) error {
+		start := time.Now()
+		defer func() {
+			es.deliverer.Metrics().Flushed(len(docs), time.Since(start))
+		}()
+		return es.writeBatch(ctx, docs)
+	})
 	if err != nil {
-		log.Log.Error(err, "")
+		log.Log.Error(err, "failed to write events")
+		for _, item := range es.batch {
+			if err := es.queue.Nack(item); err != nil {
+				log.Log.Error(err, "failed to requeue events")
+				break
+			}
+		}
 		return
 	}
+	if err := es.queue.Ack(es.batch[len(es.batch)-1]); err != nil {
+		log.Log.Error(err, "failed to acknowledge events")
+	}
+}
+
+func (es *ElasticSink) writeBatch(ctx context.Context, docs []events.Event) error {
+	body, err := es.createBody(docs)
+	if err != nil {
+		return err
+	}
 
 	req := esapi.BulkRequest{
 		Body:  &body,
@@ -118,25 +206,28 @@ func (es *ElasticSink) writeBatch(ctx context.Context, events []v1.Event) {
 
 	resp, err := req.Do(ctx, es.client)
 	if err != nil {
-		log.Log.Error(err, "")
-		return
+		return err
 	}
 
 	defer resp.Body.Close()
 	if resp.StatusCode > 399 {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			log.Log.Error(err, "")
+		err := fmt.Errorf("bulk request failed with status code: %d", resp.StatusCode)
+		if body, readErr := ioutil.ReadAll(resp.Body); readErr == nil {
+			err = fmt.Errorf("bulk request failed with status code: %d, body: %s", resp.StatusCode, string(body))
 		}
-		log.Log.Error(nil, "failed to write events", "body", string(body))
+		if sinks.Retryable(resp.StatusCode) {
+			return err
+		}
+		return sinks.Permanent(err)
 	}
+	return nil
 }
 
-func (es *ElasticSink) createBody(events []v1.Event) (bytes.Buffer, error) {
+func (es *ElasticSink) createBody(docs []events.Event) (bytes.Buffer, error) {
 	var buf bytes.Buffer
 	encoder := json.NewEncoder(&buf)
-	for _, event := range events {
-		index := IndexTemplate{Index: Index{IndexName: es.indexName, Id: string(event.UID)}}
+	for _, event := range docs {
+		index := IndexTemplate{Index: Index{IndexName: es.indexName, Id: sinks.DocumentID(event)}}
 		if err := encoder.Encode(index); err != nil {
 			if err != io.EOF {
 				log.Log.Error(err, "")
@@ -151,3 +242,111 @@ func (es *ElasticSink) createBody(events []v1.Event) (bytes.Buffer, error) {
 	}
 	return buf, nil
 }
+
+// Query runs an elasticsearch SQL query, the index is queried by its name
+// and the query parameters are bound to opts.Args. Queries reading other
+// indices are rejected.
+func (es *ElasticSink) Query(ctx context.Context, query string, opts sinks.QueryOptions) (*sinks.QueryResult, error) {
+	if err := checkQueryIndex(query, es.indexName); err != nil {
+		return nil, err
+	}
+
+	timeout := opts.QueryTimeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	limit := opts.RowLimit()
+	sqlReq := sqlRequest{
+		Query:          query,
+		Params:         opts.Args,
+		FetchSize:      limit,
+		RequestTimeout: timeout.String(),
+	}
+	if !opts.Since.IsZero() {
+		sqlReq.Filter = map[string]interface{}{
+			"range": map[string]interface{}{
+				"lastTimestamp": map[string]interface{}{
+					"gte": opts.Since.UTC().Format(time.RFC3339),
+				},
+			},
+		}
+	}
+
+	body, err := json.Marshal(sqlReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	sqlResp, err := es.sqlQuery(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := sinks.QueryResult{
+		Columns: sqlResp.Columns,
+		Rows:    sqlResp.Rows,
+	}
+	if result.Rows == nil {
+		result.Rows = make([][]interface{}, 0)
+	}
+
+	// elasticsearch returns a cursor with every full page, the result is
+	// only truncated if the next page has rows.
+	if cursor := sqlResp.Cursor; cursor != "" {
+		next, err := es.sqlQuery(ctx, []byte(fmt.Sprintf(`{"cursor":%q}`, cursor)))
+		if err != nil {
+			es.clearCursor(ctx, cursor)
+			return nil, err
+		}
+		result.Truncated = len(next.Rows) > 0
+		if next.Cursor != "" {
+			es.clearCursor(ctx, next.Cursor)
+		}
+	}
+
+	return &result, nil
+}
+
+// sqlQuery sends the SQL request body and decodes its response.
+func (es *ElasticSink) sqlQuery(ctx context.Context, body []byte) (*sqlResponse, error) {
+	req := esapi.SQLQueryRequest{
+		Body:   bytes.NewReader(body),
+		Format: "json",
+	}
+
+	resp, err := req.Do(ctx, es.client)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.IsError() {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("query failed with status code: %d", resp.StatusCode)
+		}
+		return nil, fmt.Errorf("query failed with status code: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	var sqlResp sqlResponse
+	if err := json.NewDecoder(resp.Body).Decode(&sqlResp); err != nil {
+		return nil, fmt.Errorf("failed to decode query response: %w", err)
+	}
+	return &sqlResp, nil
+}
+
+func (es *ElasticSink) clearCursor(ctx context.Context, cursor string) {
+	body, err := json.Marshal(map[string]string{"cursor": cursor})
+	if err != nil {
+		log.Log.Error(err, "")
+		return
+	}
+
+	req := esapi.SQLClearCursorRequest{Body: bytes.NewReader(body)}
+	resp, err := req.Do(ctx, es.client)
+	if err != nil {
+		log.Log.Error(err, "failed to clear query cursor")
+		return
+	}
+	resp.Body.Close()
+}
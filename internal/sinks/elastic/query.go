@@ -0,0 +1,180 @@
+package elasticSink
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	quotedToken
+	literalToken
+	punctToken
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	// end is the position in the query right after the token.
+	end int
+}
+
+// checkQueryIndex checks that the query is a select statement only reading
+// the given index. Elasticsearch SQL queries any index readable with the
+// credentials of the sink, so every FROM clause must name the index.
+func checkQueryIndex(query, index string) error {
+	runes := []rune(query)
+	tokens, err := tokenize(runes)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 || tokens[0].kind != wordToken || !strings.EqualFold(tokens[0].value, "SELECT") {
+		return fmt.Errorf("only select queries are supported")
+	}
+
+	// functions the parentheses were opened by, EXTRACT(field FROM ts)
+	// doesn't read an index.
+	var functions []string
+	for i, tok := range tokens {
+		if tok.kind == punctToken {
+			switch tok.value {
+			case "(":
+				function := ""
+				if i > 0 && tokens[i-1].kind == wordToken {
+					function = strings.ToUpper(tokens[i-1].value)
+				}
+				functions = append(functions, function)
+			case ")":
+				if len(functions) > 0 {
+					functions = functions[:len(functions)-1]
+				}
+			case ";":
+				return fmt.Errorf("only a single statement is supported")
+			}
+			continue
+		}
+
+		if tok.kind != wordToken || !strings.EqualFold(tok.value, "FROM") {
+			continue
+		}
+		if len(functions) > 0 && functions[len(functions)-1] == "EXTRACT" {
+			continue
+		}
+		if i+1 == len(tokens) {
+			return fmt.Errorf("FROM is missing its index")
+		}
+		next := tokens[i+1]
+		// subqueries are checked as the rest of the query
+		if next.kind == punctToken && next.value == "(" {
+			continue
+		}
+		if target, end := tableName(runes, tokens[i+1:]); target != index || continuesTable(runes, end) {
+			return fmt.Errorf("queries can only read the index %s", index)
+		}
+	}
+	return nil
+}
+
+// tableName returns the table name starting at the first of the tokens and
+// the position right after it. Unquoted names are made of the tokens up to
+// the first space or separator, such as logs-* or my.index.
+func tableName(runes []rune, tokens []token) (string, int) {
+	first := tokens[0]
+	if first.kind == quotedToken || first.kind == literalToken {
+		return first.value, first.end
+	}
+	start := first.end - len([]rune(first.value))
+	end := start
+	for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune("(),;'\"`", runes[end]) &&
+		!startsWith(runes, end, "--") && !startsWith(runes, end, "/*") {
+		end++
+	}
+	return string(runes[start:end]), end
+}
+
+// continuesTable reports whether the table name is followed by another
+// one, as in FROM a, b.
+func continuesTable(runes []rune, end int) bool {
+	for end < len(runes) && unicode.IsSpace(runes[end]) {
+		end++
+	}
+	return end < len(runes) && runes[end] == ','
+}
+
+// tokenize splits the query into words of identifier characters, quoted
+// identifiers, string literals and single character punctuation, skipping
+// the comments. Operators split words, so *FROM reads as * and FROM just
+// like elasticsearch does.
+func tokenize(runes []rune) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case startsWith(runes, i, "--"):
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case startsWith(runes, i, "/*"):
+			for i += 2; !startsWith(runes, i, "*/"); i++ {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("unterminated comment")
+				}
+			}
+			i += 2
+		case r == '\'' || r == '"' || r == '`':
+			value, next, err := quoted(runes, i)
+			if err != nil {
+				return nil, err
+			}
+			kind := quotedToken
+			if r == '\'' {
+				kind = literalToken
+			}
+			tokens = append(tokens, token{kind: kind, value: value, end: next})
+			i = next
+		case isIdentifier(r):
+			start := i
+			for i < len(runes) && isIdentifier(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: wordToken, value: string(runes[start:i]), end: i})
+		default:
+			i++
+			tokens = append(tokens, token{kind: punctToken, value: string(r), end: i})
+		}
+	}
+	return tokens, nil
+}
+
+func isIdentifier(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '@'
+}
+
+// quoted returns the value quoted at position i, a doubled quote escapes
+// the quote, and the position after it.
+func quoted(runes []rune, i int) (string, int, error) {
+	quote := runes[i]
+	var value strings.Builder
+	for i++; i < len(runes); i++ {
+		if runes[i] != quote {
+			value.WriteRune(runes[i])
+			continue
+		}
+		if i+1 < len(runes) && runes[i+1] == quote {
+			value.WriteRune(quote)
+			i++
+			continue
+		}
+		return value.String(), i + 1, nil
+	}
+	return "", i, fmt.Errorf("unterminated quote %c", quote)
+}
+
+func startsWith(runes []rune, i int, prefix string) bool {
+	return strings.HasPrefix(string(runes[i:]), prefix)
+}
@@ -0,0 +1,39 @@
+package elasticSink
+
+import "testing"
+
+func TestCheckQueryIndex(t *testing.T) {
+	tests := []struct {
+		query string
+		valid bool
+	}{
+		{query: `SELECT reason, COUNT(*) FROM events GROUP BY reason`, valid: true},
+		{query: `select * from "events" e WHERE e.type = 'from other'`, valid: true},
+		{query: `SELECT EXTRACT(YEAR FROM lastTimestamp) FROM events`, valid: true},
+		{query: `SELECT * FROM (SELECT reason FROM events)`, valid: true},
+		{query: `SELECT * FROM other`},
+		{query: `SELECT * FROM events, other`},
+		{query: `SELECT * FROM "events,other"`},
+		{query: `SELECT * FROM events-*`},
+		{query: `SELECT * FROM (SELECT reason FROM other)`},
+		{query: `SELECT 1,*FROM other`},
+		{query: `SELECT a/*x*/FROM other`},
+		{query: "SELECT * -- FROM events\nFROM other"},
+		{query: `SELECT * FROM events; SELECT * FROM other`},
+		{query: `SHOW TABLES`},
+		{query: `DESCRIBE other`},
+		{query: `SELECT * FROM`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			err := checkQueryIndex(tt.query, "events")
+			if tt.valid && err != nil {
+				t.Fatalf("expected the query to be accepted, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("expected the query to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package sinks
+
+import (
+	"fmt"
+
+	"github.com/ahsayde/analytics-controller/api/v1alpha1"
+	"github.com/ahsayde/analytics-controller/pkg/events"
+)
+
+// Delivery returns the update policy the event is delivered under.
+func Delivery(event events.Event) string {
+	if delivery, ok := event.Annotations[v1alpha1.DeliveryAnnotation]; ok {
+		return delivery
+	}
+	return v1alpha1.FirstOccurrenceUpdatePolicy
+}
+
+// DocumentID returns an id identifying the delivered event in the sink.
+// Events delivered as count deltas get an id per delivery so that the
+// deltas add up, other events are identified by their uid and later
+// deliveries replace the earlier ones.
+func DocumentID(event events.Event) string {
+	if Delivery(event) == v1alpha1.CountDeltaUpdatePolicy {
+		return fmt.Sprintf("%s-%d", event.UID, event.Count)
+	}
+	return string(event.UID)
+}
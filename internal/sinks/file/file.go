@@ -5,53 +5,107 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 
-	v1 "k8s.io/api/core/v1"
+	"github.com/ahsayde/analytics-controller/internal/sinks"
+	"github.com/ahsayde/analytics-controller/internal/sinks/queue"
+	"github.com/ahsayde/analytics-controller/pkg/events"
 
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 type FilesystemSink struct {
+	path      string
 	file      *os.File
-	eventChan chan v1.Event
+	queue     queue.Queue
+	deliverer *sinks.Deliverer
+	done      chan struct{}
 }
 
-func New(filePath string) (*FilesystemSink, error) {
+func New(filePath string, q queue.Queue, deliverer *sinks.Deliverer) (*FilesystemSink, error) {
 	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file %s : %w", filePath, err)
 	}
 	return &FilesystemSink{
+		path:      filePath,
 		file:      file,
-		eventChan: make(chan v1.Event, 50),
+		queue:     q,
+		deliverer: deliverer,
+		done:      make(chan struct{}),
 	}, nil
 }
 
-func (s *FilesystemSink) Write(ctx context.Context, event v1.Event) error {
-	s.eventChan <- event
-	return nil
+func (s *FilesystemSink) Write(ctx context.Context, event events.Event) error {
+	return s.queue.Push(ctx, event)
 }
 
 func (f *FilesystemSink) worker(ctx context.Context) {
+	defer close(f.done)
 	for {
-		select {
-		case event := <-f.eventChan:
-			if err := json.NewEncoder(f.file).Encode(event); err != nil {
-				log.Log.Error(err, "failed to write event to file")
-			}
-		case <-ctx.Done():
+		item, err := f.queue.Pop(ctx)
+		if err != nil {
 			return
 		}
+		err = f.deliverer.Deliver(ctx, []events.Event{item.Event}, func(context.Context) error {
+			return json.NewEncoder(f.file).Encode(item.Event)
+		})
+		if err != nil {
+			log.Log.Error(err, "failed to write event to file")
+			if err := f.queue.Nack(item); err != nil {
+				log.Log.Error(err, "failed to requeue event")
+			}
+			continue
+		}
+		if err := f.queue.Ack(item); err != nil {
+			log.Log.Error(err, "failed to acknowledge event")
+		}
 	}
 }
 
+// Probe checks that the directory of the file exists and that the file is
+// a regular file.
+func (f *FilesystemSink) Probe(ctx context.Context) error {
+	dir := filepath.Dir(f.path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to check directory %s : %w", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	info, err = f.file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to check file %s : %w", f.path, err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", f.path)
+	}
+	return nil
+}
+
+// Health returns the delivery health of the sink.
+func (f *FilesystemSink) Health() sinks.Health {
+	return f.deliverer.Health()
+}
+
 func (f *FilesystemSink) Start(ctx context.Context) error {
 	go f.worker(ctx)
 	return nil
 }
 
+// Stop closes the queue, waits for the events left in memory to be written
+// and closes the file.
 func (f *FilesystemSink) Stop() error {
-	close(f.eventChan)
+	if err := f.queue.Close(); err != nil {
+		log.Log.Error(err, "failed to close queue")
+	}
+	f.deliverer.Stop()
+	<-f.done
+	if err := f.deliverer.Close(); err != nil {
+		log.Log.Error(err, "failed to close dead-letter target")
+	}
 	defer f.file.Close()
 	if err := f.file.Sync(); err != nil {
 		return fmt.Errorf("failed to write all results to file : %w", err)
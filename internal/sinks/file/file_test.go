@@ -0,0 +1,56 @@
+package fileSink
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ahsayde/analytics-controller/internal/sinks"
+	"github.com/ahsayde/analytics-controller/internal/sinks/queue"
+)
+
+func newTestSink(t *testing.T, path string) *FilesystemSink {
+	sink, err := New(path, queue.NewMemory(queue.MemoryOptions{}), sinks.NewDeliverer(sinks.DelivererOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sink.Stop() })
+	return sink
+}
+
+func TestProbe(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "events")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	sink := newTestSink(t, filepath.Join(dir, "events.json"))
+
+	if err := sink.Probe(context.Background()); err != nil {
+		t.Fatalf("expected the probe to succeed, got %s", err)
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Probe(context.Background()); err == nil {
+		t.Error("expected the probe to fail once the directory is removed")
+	}
+}
+
+func TestProbeNotRegularFile(t *testing.T) {
+	sink := newTestSink(t, os.DevNull)
+	if err := sink.Probe(context.Background()); err == nil {
+		t.Errorf("expected the probe of %s to fail", os.DevNull)
+	}
+}
+
+func TestNewMissingDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "missing", "events.json")
+	if _, err := New(path, queue.NewMemory(queue.MemoryOptions{}), sinks.NewDeliverer(sinks.DelivererOptions{})); err == nil {
+		t.Error("expected the sink to fail to open a file in a missing directory")
+	}
+}
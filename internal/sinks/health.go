@@ -0,0 +1,135 @@
+package sinks
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultFailureThreshold number of consecutive failures opening the
+	// circuit breaker.
+	DefaultFailureThreshold = 5
+	// DefaultOpenDuration how long the circuit breaker stays open before a
+	// send is attempted again.
+	DefaultOpenDuration = 30 * time.Second
+
+	// probeWaitInterval how often a send waiting for the circuit breaker
+	// checks whether the probe in progress closed it.
+	probeWaitInterval = time.Second
+)
+
+// ErrCircuitOpen is returned instead of sending events while the circuit
+// breaker of a stopping sink is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Health is the delivery health of a sink.
+type Health struct {
+	ConsecutiveFailures int
+	LastSuccess         time.Time
+	LastFailure         time.Time
+	LastError           string
+	CircuitOpen         bool
+}
+
+// Breaker tracks the delivery health of a sink and opens after repeated
+// failures, so that a failing backend isn't sent every event. Once open, a
+// single send is allowed after the open duration, its success closes the
+// breaker again. It is safe for concurrent use.
+type Breaker struct {
+	threshold    int
+	openDuration time.Duration
+
+	mu       sync.Mutex
+	health   Health
+	openedAt time.Time
+	probing  bool
+}
+
+func NewBreaker(threshold int, openDuration time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = DefaultFailureThreshold
+	}
+	if openDuration <= 0 {
+		openDuration = DefaultOpenDuration
+	}
+	return &Breaker{
+		threshold:    threshold,
+		openDuration: openDuration,
+	}
+}
+
+// Allow reports whether a send may be attempted.
+func (b *Breaker) Allow() bool {
+	_, ok := b.allow()
+	return ok
+}
+
+// Wait blocks until a send may be attempted. ErrCircuitOpen is returned if
+// stop is closed first, the context error if it is done.
+func (b *Breaker) Wait(ctx context.Context, stop <-chan struct{}) error {
+	for {
+		wait, ok := b.allow()
+		if ok {
+			return nil
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-stop:
+			timer.Stop()
+			return ErrCircuitOpen
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// allow reports whether a send may be attempted, or how long to wait
+// before asking again.
+func (b *Breaker) allow() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.health.CircuitOpen {
+		return 0, true
+	}
+	if b.probing {
+		return probeWaitInterval, false
+	}
+	if wait := b.openDuration - time.Since(b.openedAt); wait > 0 {
+		return wait, false
+	}
+	b.probing = true
+	return 0, true
+}
+
+// Record records the outcome of a send.
+func (b *Breaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	now := time.Now()
+
+	if err == nil {
+		b.health.ConsecutiveFailures = 0
+		b.health.LastSuccess = now
+		b.health.CircuitOpen = false
+		return
+	}
+
+	b.health.ConsecutiveFailures++
+	b.health.LastFailure = now
+	b.health.LastError = err.Error()
+	if b.health.CircuitOpen || b.health.ConsecutiveFailures >= b.threshold {
+		b.health.CircuitOpen = true
+		b.openedAt = now
+	}
+}
+
+func (b *Breaker) Health() Health {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.health
+}
@@ -0,0 +1,37 @@
+package sinks
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	breaker := NewBreaker(2, 10*time.Millisecond)
+	errUnavailable := errors.New("service unavailable")
+
+	breaker.Record(errUnavailable)
+	if !breaker.Allow() {
+		t.Fatal("expected the breaker to stay closed below the threshold")
+	}
+	breaker.Record(errUnavailable)
+	if breaker.Allow() {
+		t.Fatal("expected the breaker to open at the threshold")
+	}
+	if health := breaker.Health(); !health.CircuitOpen || health.ConsecutiveFailures != 2 || health.LastError != errUnavailable.Error() {
+		t.Fatalf("unexpected health %+v", health)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if !breaker.Allow() {
+		t.Fatal("expected a probe once the open duration passed")
+	}
+	if breaker.Allow() {
+		t.Fatal("expected a single probe at a time")
+	}
+
+	breaker.Record(nil)
+	if health := breaker.Health(); health.CircuitOpen || health.ConsecutiveFailures != 0 || health.LastSuccess.IsZero() {
+		t.Fatalf("expected the breaker to close after a successful probe, got %+v", health)
+	}
+}
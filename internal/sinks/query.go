@@ -0,0 +1,78 @@
+package sinks
+
+import "time"
+
+const (
+	// DefaultQueryLimit is the number of rows returned when a query sets no limit.
+	DefaultQueryLimit = 1000
+	// MaxQueryLimit is the highest row limit a query can set.
+	MaxQueryLimit = 10000
+	// DefaultQueryTimeout is the query timeout when a query sets none.
+	DefaultQueryTimeout = 10 * time.Second
+	// MaxQueryTimeout is the highest timeout a query can set.
+	MaxQueryTimeout = time.Minute
+)
+
+// QueryOptions options applied to queries run against a sink.
+type QueryOptions struct {
+	// Since restricts the query to events with a lastTimestamp at or after
+	// it. The zero value means no restriction.
+	Since time.Time
+
+	// Args values bound to the query parameters.
+	Args []interface{}
+
+	// Limit maximum number of rows to return, capped at MaxQueryLimit.
+	Limit int
+
+	// Timeout of the query, capped at MaxQueryTimeout.
+	Timeout time.Duration
+}
+
+// RowLimit returns the row limit of the query with the defaults applied.
+func (o QueryOptions) RowLimit() int {
+	if o.Limit <= 0 {
+		return DefaultQueryLimit
+	}
+	if o.Limit > MaxQueryLimit {
+		return MaxQueryLimit
+	}
+	return o.Limit
+}
+
+// QueryTimeout returns the timeout of the query with the defaults applied.
+func (o QueryOptions) QueryTimeout() time.Duration {
+	if o.Timeout <= 0 {
+		return DefaultQueryTimeout
+	}
+	if o.Timeout > MaxQueryTimeout {
+		return MaxQueryTimeout
+	}
+	return o.Timeout
+}
+
+type Column struct {
+	Name string `json:"name"`
+	// Type database type of the column, empty if the sink can't tell.
+	Type string `json:"type,omitempty"`
+}
+
+type QueryResult struct {
+	Columns []Column        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+	// Truncated is true if the query returned more rows than the limit.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Maps returns the result rows as maps keyed by the column names.
+func (r *QueryResult) Maps() []map[string]interface{} {
+	maps := make([]map[string]interface{}, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		m := make(map[string]interface{}, len(r.Columns))
+		for i, column := range r.Columns {
+			m[column.Name] = row[i]
+		}
+		maps = append(maps, m)
+	}
+	return maps
+}
@@ -0,0 +1,279 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/api/v1alpha1"
+	"github.com/ahsayde/analytics-controller/internal/metrics"
+	"github.com/ahsayde/analytics-controller/pkg/events"
+)
+
+const (
+	DefaultSize         = 50
+	DefaultBlockTimeout = time.Second
+)
+
+var (
+	// ErrClosed is returned when pushing to a closed queue or popping from
+	// a closed queue with nothing left to deliver.
+	ErrClosed = errors.New("queue is closed")
+	// ErrQueueFull is returned when an event is dropped because the queue
+	// is full.
+	ErrQueueFull = errors.New("queue is full")
+)
+
+// Item is an event popped from a queue.
+type Item struct {
+	Event events.Event
+	// pos is the position of the event in a spool and next the position
+	// right after it, both are zero for in-memory queues.
+	pos, next position
+}
+
+// Queue holds the events written to a sink until its worker delivers them.
+// Popped items must be either acknowledged once delivered or negatively
+// acknowledged if the delivery failed.
+type Queue interface {
+	// Push adds an event to the queue.
+	Push(ctx context.Context, event events.Event) error
+	// Pop blocks until an event is available or the context is done.
+	Pop(ctx context.Context) (Item, error)
+	// Ack marks the item and all the items popped before it as delivered.
+	Ack(item Item) error
+	// Nack reports that the item failed to be delivered. Durable queues
+	// deliver it again, in-memory queues drop it.
+	Nack(item Item) error
+	// Close stops accepting events. In-memory queues can still be popped
+	// until drained, durable queues keep the remaining events for the next
+	// time they are opened.
+	Close() error
+}
+
+// MemoryOptions configures an in-memory queue.
+type MemoryOptions struct {
+	// Size maximum number of events held in memory, defaults to DefaultSize.
+	Size int
+	// OverflowPolicy what happens to the events pushed while the queue is
+	// full, defaults to BlockWithTimeout.
+	OverflowPolicy string
+	// BlockTimeout how long pushes wait for room in the queue under the
+	// BlockWithTimeout policy, defaults to DefaultBlockTimeout.
+	BlockTimeout time.Duration
+	// Spill spools the events overflowing the queue under the SpillToDisk
+	// policy.
+	Spill *Spool
+	// OnDrop is called for every dropped event.
+	OnDrop func()
+	// Metrics records the depth of the queue.
+	Metrics *metrics.SinkMetrics
+}
+
+// Memory is an in-memory queue, its events are lost if the process exits
+// before they are delivered. Events overflowing a queue with a spill are
+// not lost, they are delivered when it is opened again.
+type Memory struct {
+	opts MemoryOptions
+
+	mu     sync.Mutex
+	events []events.Event
+	// spilling is set while the spill holds events, new events are spilled
+	// too so that they are delivered in order.
+	spilling bool
+	closed   bool
+
+	pushed  chan struct{}
+	popped  chan struct{}
+	closing chan struct{}
+}
+
+func NewMemory(opts MemoryOptions) *Memory {
+	if opts.Size <= 0 {
+		opts.Size = DefaultSize
+	}
+	if opts.OverflowPolicy == "" {
+		opts.OverflowPolicy = v1alpha1.BlockWithTimeoutOverflowPolicy
+	}
+	if opts.BlockTimeout <= 0 {
+		opts.BlockTimeout = DefaultBlockTimeout
+	}
+	return &Memory{
+		opts:   opts,
+		events: make([]events.Event, 0, opts.Size),
+		// deliver the events spilled before the queue was last closed first
+		spilling: opts.Spill != nil,
+		pushed:   make(chan struct{}, 1),
+		popped:   make(chan struct{}, 1),
+		closing:  make(chan struct{}),
+	}
+}
+
+// Push adds the event to the queue, applying the overflow policy if it is
+// full. ErrQueueFull is returned if the event is dropped.
+func (m *Memory) Push(ctx context.Context, event events.Event) error {
+	var timeout <-chan time.Time
+
+	m.mu.Lock()
+	for {
+		if m.closed {
+			m.mu.Unlock()
+			return ErrClosed
+		}
+
+		if m.spilling {
+			err := m.opts.Spill.Push(ctx, event)
+			m.reportDepth()
+			m.mu.Unlock()
+			if err != nil {
+				m.drop()
+				return err
+			}
+			signal(m.pushed)
+			return nil
+		}
+
+		if len(m.events) < m.opts.Size {
+			m.events = append(m.events, event)
+			m.reportDepth()
+			m.mu.Unlock()
+			signal(m.pushed)
+			return nil
+		}
+
+		switch m.opts.OverflowPolicy {
+		case v1alpha1.DropNewestOverflowPolicy:
+			m.mu.Unlock()
+			m.drop()
+			return ErrQueueFull
+		case v1alpha1.DropOldestOverflowPolicy:
+			m.events = append(m.events[1:], event)
+			m.mu.Unlock()
+			m.drop()
+			return nil
+		case v1alpha1.SpillToDiskOverflowPolicy:
+			if m.opts.Spill != nil {
+				m.spilling = true
+				continue
+			}
+		}
+
+		m.mu.Unlock()
+		if timeout == nil {
+			timer := time.NewTimer(m.opts.BlockTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-m.popped:
+		case <-m.closing:
+		case <-timeout:
+			m.drop()
+			return ErrQueueFull
+		case <-ctx.Done():
+			m.drop()
+			return ctx.Err()
+		}
+		m.mu.Lock()
+	}
+}
+
+// Pop returns the queued events in order, the events in memory first and
+// then the spilled ones.
+func (m *Memory) Pop(ctx context.Context) (Item, error) {
+	for {
+		m.mu.Lock()
+		if len(m.events) > 0 {
+			event := m.events[0]
+			m.events = m.events[1:]
+			m.reportDepth()
+			m.mu.Unlock()
+			signal(m.popped)
+			return Item{Event: event}, nil
+		}
+
+		if m.spilling {
+			item, ok, err := m.opts.Spill.tryPop()
+			if err != nil {
+				m.mu.Unlock()
+				return Item{}, err
+			}
+			if ok {
+				m.reportDepth()
+				m.mu.Unlock()
+				// spilled events are delivered at most once
+				if err := m.opts.Spill.Ack(item); err != nil {
+					return Item{}, err
+				}
+				return Item{Event: item.Event}, nil
+			}
+			if !m.closed {
+				m.spilling = false
+			}
+		}
+
+		if m.closed {
+			m.mu.Unlock()
+			return Item{}, ErrClosed
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-m.pushed:
+		case <-m.closing:
+		case <-ctx.Done():
+			return Item{}, ctx.Err()
+		}
+	}
+}
+
+func (m *Memory) Ack(Item) error {
+	return nil
+}
+
+// Nack drops the item, it is counted as dropped.
+func (m *Memory) Nack(Item) error {
+	m.drop()
+	return nil
+}
+
+// Close stops accepting events, the events in memory can still be popped
+// while the spilled ones are kept on disk.
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	close(m.closing)
+	if m.opts.Spill != nil {
+		return m.opts.Spill.Close()
+	}
+	return nil
+}
+
+// reportDepth records the number of queued events, it is called with the
+// lock held.
+func (m *Memory) reportDepth() {
+	depth := len(m.events)
+	if m.opts.Spill != nil {
+		depth += m.opts.Spill.Len()
+	}
+	m.opts.Metrics.QueueDepth(depth)
+}
+
+func (m *Memory) drop() {
+	if m.opts.OnDrop != nil {
+		m.opts.OnDrop()
+	}
+}
+
+// signal notifies a waiting goroutine without blocking.
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,108 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/api/v1alpha1"
+)
+
+func popNames(t *testing.T, q Queue, n int) []string {
+	t.Helper()
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		item, err := q.Pop(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("pop: %v", err)
+		}
+		names = append(names, item.Event.Name)
+	}
+	return names
+}
+
+func TestMemoryOverflowPolicies(t *testing.T) {
+	tests := []struct {
+		policy  string
+		pushErr error
+		want    []string
+	}{
+		{
+			policy:  v1alpha1.DropNewestOverflowPolicy,
+			pushErr: ErrQueueFull,
+			want:    []string{"event-0", "event-1"},
+		},
+		{
+			policy: v1alpha1.DropOldestOverflowPolicy,
+			want:   []string{"event-1", "event-2"},
+		},
+		{
+			policy:  v1alpha1.BlockWithTimeoutOverflowPolicy,
+			pushErr: ErrQueueFull,
+			want:    []string{"event-0", "event-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			var dropped int
+			q := NewMemory(MemoryOptions{
+				Size:           2,
+				OverflowPolicy: tt.policy,
+				BlockTimeout:   10 * time.Millisecond,
+				OnDrop:         func() { dropped++ },
+			})
+			defer q.Close()
+
+			ctx := context.Background()
+			for i := 0; i < 2; i++ {
+				if err := q.Push(ctx, newEvent(i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := q.Push(ctx, newEvent(2)); !errors.Is(err, tt.pushErr) {
+				t.Fatalf("expected error %v, got %v", tt.pushErr, err)
+			}
+			if dropped != 1 {
+				t.Fatalf("expected 1 dropped event, got %d", dropped)
+			}
+
+			got := popNames(t, q, 2)
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestMemorySpillToDiskKeepsOrder(t *testing.T) {
+	spill, err := OpenSpool(t.TempDir(), DefaultSegmentSize, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := NewMemory(MemoryOptions{
+		Size:           2,
+		OverflowPolicy: v1alpha1.SpillToDiskOverflowPolicy,
+		Spill:          spill,
+	})
+	defer q.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		if err := q.Push(ctx, newEvent(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := popNames(t, q, 5)
+	for i, name := range got {
+		if name != newEvent(i).Name {
+			t.Fatalf("expected the events in order, got %v", got)
+		}
+	}
+}
@@ -0,0 +1,591 @@
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/internal/metrics"
+	"github.com/ahsayde/analytics-controller/pkg/events"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	DefaultSegmentSize int64 = 8 << 20
+
+	// retryInterval is how long a spool waits before delivering a negatively
+	// acknowledged item again.
+	retryInterval = 5 * time.Second
+
+	segmentExt = ".seg"
+	ackFile    = "ack"
+
+	// recordHeaderSize is the size of the header preceding each record, the
+	// length of the record followed by its CRC32 checksum.
+	recordHeaderSize = 8
+)
+
+var errIncompleteRecord = errors.New("incomplete record")
+
+// position is the offset of a record in a segment.
+type position struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+func (p position) before(o position) bool {
+	return p.Segment < o.Segment || (p.Segment == o.Segment && p.Offset < o.Offset)
+}
+
+// Spool is a durable queue backed by a write-ahead log of segment files. The
+// events are appended to the last segment and popped in order, the position
+// up to which they were acknowledged is persisted and segments are removed
+// once all their events are acknowledged. Events that were not acknowledged
+// before the spool is closed, or the process exits, are delivered again
+// when the spool is reopened.
+//
+// Records are not synced to disk one by one, so they survive the process
+// exiting but not the node crashing. A spool supports a single consumer.
+type Spool struct {
+	dir         string
+	segmentSize int64
+
+	mu sync.Mutex
+	// writer is the segment the events are appended to, writePos is the
+	// position of the next record.
+	writer   *os.File
+	writePos position
+	// reader is the segment the events are popped from, readPos is the
+	// position of the next record.
+	reader  *os.File
+	readPos position
+	// acked is the position up to which the events were delivered.
+	acked position
+	// first is the oldest segment on disk.
+	first uint64
+	// pending is the number of events not popped yet.
+	pending int
+	metrics *metrics.SinkMetrics
+	retryAt time.Time
+	closed  bool
+
+	notify  chan struct{}
+	closing chan struct{}
+}
+
+// OpenSpool opens the spool in the given directory, creating it if needed.
+// A record partially written when the process exited is discarded. The
+// metrics record the depth of the spool, they may be nil.
+func OpenSpool(dir string, segmentSize int64, sinkMetrics *metrics.SinkMetrics) (*Spool, error) {
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory %s : %w", dir, err)
+	}
+
+	s := &Spool{
+		dir:         dir,
+		segmentSize: segmentSize,
+		metrics:     sinkMetrics,
+		notify:      make(chan struct{}, 1),
+		closing:     make(chan struct{}),
+	}
+	if err := s.recover(); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Spool) recover() error {
+	acked, err := s.loadAck()
+	if err != nil {
+		return err
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+
+	kept := segments[:0]
+	for _, id := range segments {
+		if id < acked.Segment {
+			if err := os.Remove(s.segmentPath(id)); err != nil {
+				return fmt.Errorf("failed to remove delivered spool segment: %w", err)
+			}
+			continue
+		}
+		kept = append(kept, id)
+	}
+
+	if len(kept) == 0 {
+		id := acked.Segment + 1
+		file, err := os.OpenFile(s.segmentPath(id), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create spool segment: %w", err)
+		}
+		s.writer = file
+		s.writePos = position{Segment: id}
+		kept = append(kept, id)
+	} else {
+		last := kept[len(kept)-1]
+		end, err := s.validEnd(last)
+		if err != nil {
+			return err
+		}
+		file, err := os.OpenFile(s.segmentPath(last), os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open spool segment: %w", err)
+		}
+		s.writer = file
+		if err := file.Truncate(end); err != nil {
+			return fmt.Errorf("failed to truncate spool segment: %w", err)
+		}
+		s.writePos = position{Segment: last, Offset: end}
+	}
+
+	s.first = kept[0]
+	s.acked = acked
+	readPos := acked
+	if readPos.Segment != kept[0] {
+		readPos = position{Segment: kept[0]}
+	}
+	if err := s.openReader(readPos.Segment); err != nil {
+		return err
+	}
+	if readPos.Segment == s.writePos.Segment && s.writePos.Offset < readPos.Offset {
+		readPos.Offset = s.writePos.Offset
+	}
+	s.readPos = readPos
+	s.setPending(s.count(s.readPos, s.writePos))
+
+	return nil
+}
+
+// validEnd returns the end of the last complete record of a segment.
+func (s *Spool) validEnd(id uint64) (int64, error) {
+	file, err := os.Open(s.segmentPath(id))
+	if err != nil {
+		return 0, fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	var offset int64
+	for offset < info.Size() {
+		_, next, err := readRecord(file, offset, info.Size())
+		if err != nil {
+			log.Log.Error(err, "discarding the end of spool segment", "segment", s.segmentPath(id), "offset", offset)
+			break
+		}
+		offset = next
+	}
+	return offset, nil
+}
+
+func (s *Spool) Push(ctx context.Context, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrClosed
+	}
+
+	size := int64(recordHeaderSize + len(data))
+	if s.writePos.Offset > 0 && s.writePos.Offset+size > s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	record := make([]byte, size)
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(data))
+	copy(record[recordHeaderSize:], data)
+
+	if _, err := s.writer.Write(record); err != nil {
+		// drop the partially written record
+		s.writer.Truncate(s.writePos.Offset)
+		return fmt.Errorf("failed to write to spool: %w", err)
+	}
+	s.writePos.Offset += size
+	s.setPending(s.pending + 1)
+
+	signal(s.notify)
+
+	return nil
+}
+
+// rotate seals the current segment and starts a new one.
+func (s *Spool) rotate() error {
+	if err := s.writer.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spool segment: %w", err)
+	}
+	s.writer.Close()
+
+	id := s.writePos.Segment + 1
+	file, err := os.OpenFile(s.segmentPath(id), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create spool segment: %w", err)
+	}
+	s.writer = file
+	s.writePos = position{Segment: id}
+	return nil
+}
+
+func (s *Spool) Pop(ctx context.Context) (Item, error) {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return Item{}, ErrClosed
+		}
+		wait := time.Until(s.retryAt)
+		if wait <= 0 {
+			item, ok, err := s.next()
+			if err != nil || ok {
+				s.mu.Unlock()
+				return item, err
+			}
+		}
+		s.mu.Unlock()
+
+		if err := s.wait(ctx, wait); err != nil {
+			return Item{}, err
+		}
+	}
+}
+
+// tryPop returns the next event without waiting for one, ignoring the retry
+// interval.
+func (s *Spool) tryPop() (Item, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return Item{}, false, nil
+	}
+	return s.next()
+}
+
+// wait blocks until an event is pushed, the retry delay passes, the spool
+// is closed or the context is done.
+func (s *Spool) wait(ctx context.Context, retry time.Duration) error {
+	var retryC <-chan time.Time
+	if retry > 0 {
+		timer := time.NewTimer(retry)
+		defer timer.Stop()
+		retryC = timer.C
+	}
+
+	select {
+	case <-s.notify:
+	case <-retryC:
+	case <-s.closing:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// next reads the next record, ok is false if there is none yet.
+func (s *Spool) next() (item Item, ok bool, err error) {
+	for {
+		limit := s.writePos.Offset
+		sealed := s.readPos.Segment < s.writePos.Segment
+		if sealed {
+			info, err := s.reader.Stat()
+			if err != nil {
+				return Item{}, false, err
+			}
+			limit = info.Size()
+		}
+
+		if s.readPos.Offset >= limit {
+			if !sealed {
+				return Item{}, false, nil
+			}
+			if err := s.openReader(s.readPos.Segment + 1); err != nil {
+				return Item{}, false, err
+			}
+			s.readPos = position{Segment: s.readPos.Segment + 1}
+			continue
+		}
+
+		data, next, err := readRecord(s.reader, s.readPos.Offset, limit)
+		if err != nil {
+			if !sealed {
+				return Item{}, false, err
+			}
+			log.Log.Error(err, "skipping the end of spool segment", "segment", s.segmentPath(s.readPos.Segment), "offset", s.readPos.Offset)
+			s.readPos.Offset = limit
+			continue
+		}
+
+		item := Item{
+			pos:  s.readPos,
+			next: position{Segment: s.readPos.Segment, Offset: next},
+		}
+		s.readPos = item.next
+		s.setPending(s.pending - 1)
+		if err := json.Unmarshal(data, &item.Event); err != nil {
+			log.Log.Error(err, "skipping invalid spool record", "segment", s.segmentPath(item.pos.Segment), "offset", item.pos.Offset)
+			continue
+		}
+		return item, true, nil
+	}
+}
+
+// Ack persists the position after the item and removes the segments whose
+// events were all delivered.
+func (s *Spool) Ack(item Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.acked.before(item.next) {
+		return nil
+	}
+	s.acked = item.next
+
+	if err := s.saveAck(); err != nil {
+		return err
+	}
+
+	for ; s.first < s.acked.Segment; s.first++ {
+		if err := os.Remove(s.segmentPath(s.first)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove delivered spool segment: %w", err)
+		}
+	}
+	return nil
+}
+
+// Nack rewinds the spool to the item, it is popped again once the retry
+// interval passes.
+func (s *Spool) Nack(item Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	if item.pos.before(s.readPos) {
+		if item.pos.Segment != s.readPos.Segment {
+			if err := s.openReader(item.pos.Segment); err != nil {
+				return err
+			}
+		}
+		s.setPending(s.pending + s.count(item.pos, s.readPos))
+		s.readPos = item.pos
+	}
+	s.retryAt = time.Now().Add(retryInterval)
+	return nil
+}
+
+// Len returns the number of events not popped yet.
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+func (s *Spool) setPending(pending int) {
+	if pending < 0 {
+		pending = 0
+	}
+	s.pending = pending
+	s.metrics.QueueDepth(pending)
+}
+
+// count returns the number of records between two positions, only reading
+// the record headers.
+func (s *Spool) count(from, to position) int {
+	count := 0
+	header := make([]byte, recordHeaderSize)
+	for id := from.Segment; id <= to.Segment; id++ {
+		file, err := os.Open(s.segmentPath(id))
+		if err != nil {
+			continue
+		}
+
+		var offset, limit int64
+		if id == from.Segment {
+			offset = from.Offset
+		}
+		if id == to.Segment {
+			limit = to.Offset
+		} else if info, err := file.Stat(); err == nil {
+			limit = info.Size()
+		}
+
+		for offset+recordHeaderSize <= limit {
+			if _, err := file.ReadAt(header, offset); err != nil {
+				break
+			}
+			offset += recordHeaderSize + int64(binary.BigEndian.Uint32(header[0:4]))
+			if offset > limit {
+				break
+			}
+			count++
+		}
+		file.Close()
+	}
+	return count
+}
+
+// Close syncs the spool to disk and releases it, Pop returns ErrClosed
+// right away.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.closing)
+
+	var err error
+	if syncErr := s.writer.Sync(); syncErr != nil {
+		err = fmt.Errorf("failed to sync spool segment: %w", syncErr)
+	}
+	s.closeFiles()
+	return err
+}
+
+func (s *Spool) closeFiles() {
+	if s.writer != nil {
+		s.writer.Close()
+	}
+	if s.reader != nil {
+		s.reader.Close()
+	}
+}
+
+func (s *Spool) openReader(id uint64) error {
+	file, err := os.Open(s.segmentPath(id))
+	if err != nil {
+		return fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	if s.reader != nil {
+		s.reader.Close()
+	}
+	s.reader = file
+	return nil
+}
+
+func (s *Spool) loadAck() (position, error) {
+	var pos position
+	data, err := os.ReadFile(filepath.Join(s.dir, ackFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return pos, nil
+		}
+		return pos, fmt.Errorf("failed to read spool acknowledgement: %w", err)
+	}
+	if err := json.Unmarshal(data, &pos); err != nil {
+		return pos, fmt.Errorf("failed to decode spool acknowledgement: %w", err)
+	}
+	return pos, nil
+}
+
+// saveAck writes the acknowledged position to a temporary file renamed over
+// the previous one, so it is never left partially written.
+func (s *Spool) saveAck() error {
+	data, err := json.Marshal(s.acked)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, ackFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write spool acknowledgement: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, ackFile)); err != nil {
+		return fmt.Errorf("failed to write spool acknowledgement: %w", err)
+	}
+	return nil
+}
+
+// segments returns the ids of the segments on disk in order.
+func (s *Spool) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spool segments: %w", err)
+	}
+
+	ids := make([]uint64, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 16, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016x%s", id, segmentExt))
+}
+
+// readRecord reads the record at the given offset of a segment, not reading
+// past limit, and returns the offset of the next record.
+func readRecord(file *os.File, offset, limit int64) ([]byte, int64, error) {
+	if offset+recordHeaderSize > limit {
+		return nil, 0, errIncompleteRecord
+	}
+
+	header := make([]byte, recordHeaderSize)
+	if _, err := file.ReadAt(header, offset); err != nil {
+		if err == io.EOF {
+			return nil, 0, errIncompleteRecord
+		}
+		return nil, 0, err
+	}
+
+	size := int64(binary.BigEndian.Uint32(header[0:4]))
+	next := offset + recordHeaderSize + size
+	if next > limit {
+		return nil, 0, errIncompleteRecord
+	}
+
+	data := make([]byte, size)
+	if _, err := file.ReadAt(data, offset+recordHeaderSize); err != nil {
+		if err == io.EOF {
+			return nil, 0, errIncompleteRecord
+		}
+		return nil, 0, err
+	}
+
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, errors.New("record checksum mismatch")
+	}
+	return data, next, nil
+}
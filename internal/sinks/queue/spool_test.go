@@ -0,0 +1,152 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/pkg/events"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newEvent(i int) events.Event {
+	return events.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("event-%d", i),
+			UID:  types.UID(fmt.Sprintf("uid-%d", i)),
+		},
+		Message: "message",
+	}
+}
+
+func pop(t *testing.T, s *Spool) Item {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	item, err := s.Pop(ctx)
+	if err != nil {
+		t.Fatalf("pop: %v", err)
+	}
+	return item
+}
+
+func TestSpoolRedeliversUnacknowledged(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	s, err := OpenSpool(dir, 512, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := s.Push(ctx, newEvent(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 6; i++ {
+		item := pop(t, s)
+		if item.Event.Name != newEvent(i).Name {
+			t.Fatalf("expected %s, got %s", newEvent(i).Name, item.Event.Name)
+		}
+		if i < 4 {
+			if err := s.Ack(item); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = OpenSpool(dir, 512, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Len() != 6 {
+		t.Fatalf("expected 6 pending events, got %d", s.Len())
+	}
+	for i := 4; i < 10; i++ {
+		item := pop(t, s)
+		if item.Event.Name != newEvent(i).Name {
+			t.Fatalf("expected %s, got %s", newEvent(i).Name, item.Event.Name)
+		}
+		if err := s.Ack(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	segments, err := s.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 {
+		t.Fatalf("expected the delivered segments to be removed, found %d", len(segments))
+	}
+}
+
+func TestSpoolDiscardsPartialRecord(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	s, err := OpenSpool(dir, DefaultSegmentSize, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.Push(ctx, newEvent(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	segment := s.segmentPath(s.writePos.Segment)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.OpenFile(segment, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte{0, 0, 1, 0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	s, err = OpenSpool(dir, DefaultSegmentSize, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Push(ctx, newEvent(2)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if item := pop(t, s); item.Event.Name != newEvent(i).Name {
+			t.Fatalf("expected %s, got %s", newEvent(i).Name, item.Event.Name)
+		}
+	}
+}
+
+func TestSpoolNackRedelivers(t *testing.T) {
+	s, err := OpenSpool(t.TempDir(), DefaultSegmentSize, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Push(context.Background(), newEvent(0)); err != nil {
+		t.Fatal(err)
+	}
+	item := pop(t, s)
+	if err := s.Nack(item); err != nil {
+		t.Fatal(err)
+	}
+	// skip the retry interval
+	s.retryAt = time.Time{}
+	if again := pop(t, s); again.Event.Name != item.Event.Name {
+		t.Fatalf("expected %s to be redelivered, got %s", item.Event.Name, again.Event.Name)
+	}
+}
@@ -1,4 +1,4 @@
-INSERT OR IGNORE INTO events(
+INSERT INTO events(
     "uid",
     "type",
     "reason",
@@ -30,4 +30,8 @@ INSERT OR IGNORE INTO events(
     ?,
     ?,
     ?
-)
+) ON CONFLICT("uid") DO UPDATE SET
+    "message" = excluded."message",
+    "count" = excluded."count",
+    "lastTimestamp" = excluded."lastTimestamp"
+WHERE excluded."count" >= "events"."count"
@@ -3,14 +3,34 @@ package sqliteSink
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
 
+	"github.com/ahsayde/analytics-controller/internal/metrics"
+	"github.com/ahsayde/analytics-controller/internal/sinks"
+	"github.com/ahsayde/analytics-controller/pkg/events"
 	_ "github.com/mattn/go-sqlite3"
 
 	_ "embed"
 
-	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// timeFormat is the sqlite datetime format, storing timestamps with it
+// allows comparing them as text and using them with the date functions.
+const timeFormat = "2006-01-02 15:04:05"
+
+// legacyTimeFormat is the format of the timestamps stored by the earlier
+// versions, they are migrated to timeFormat when the database is opened.
+const legacyTimeFormat = "2006-01-02 15:04:05.999999999 -0700 MST"
+
+// windowTable shadows the events table with the events inside the query
+// window, the table itself stays reachable as main."events".
+const windowTable = `"events" AS (SELECT * FROM main."events" WHERE "lastTimestamp" >= '%s')`
+
 var (
 	//go:embed table.sql
 	createTableQuery string
@@ -19,30 +39,56 @@ var (
 )
 
 type SqliteSink struct {
-	db *sql.DB
+	path    string
+	metrics *metrics.SinkMetrics
+	db      *sql.DB
+	// reader is a read only connection used to run queries.
+	reader *sql.DB
 }
 
-func New(dbPath string) (*SqliteSink, error) {
+func New(dbPath string, sinkMetrics *metrics.SinkMetrics) (*SqliteSink, error) {
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return nil, err
 	}
 
 	if _, err := db.Exec(createTableQuery); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err := migrateTimestamps(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate timestamps: %w", err)
+	}
+
+	reader, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&_query_only=true", dbPath))
+	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return &SqliteSink{
-		db: db,
+		path:    dbPath,
+		metrics: sinkMetrics,
+		db:      db,
+		reader:  reader,
 	}, nil
 }
 
-func (s *SqliteSink) Write(ctx context.Context, event v1.Event) error {
-	statement, err := s.db.Prepare(insertRowQuery)
+// Probe checks that the database file is writable.
+func (s *SqliteSink) Probe(ctx context.Context) error {
+	file, err := os.OpenFile(s.path, os.O_WRONLY, 0)
 	if err != nil {
-		return err
+		return fmt.Errorf("database file %s is not writable: %w", s.path, err)
 	}
-	_, err = statement.Exec(
+	return file.Close()
+}
+
+func (s *SqliteSink) Write(ctx context.Context, event events.Event) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		insertRowQuery,
 		event.UID,
 		event.Type,
 		event.Reason,
@@ -51,20 +97,178 @@ func (s *SqliteSink) Write(ctx context.Context, event v1.Event) error {
 		event.Count,
 		event.ReportingController,
 		event.ReportingInstance,
-		event.FirstTimestamp.String(),
-		event.LastTimestamp.String(),
+		formatTime(event.FirstTimestamp),
+		formatTime(event.LastTimestamp),
 		event.InvolvedObject.UID,
 		event.InvolvedObject.APIVersion,
 		event.InvolvedObject.Kind,
 		event.InvolvedObject.Name,
 		event.InvolvedObject.Namespace,
 	)
+	if err != nil {
+		s.metrics.Failed(1)
+		return err
+	}
 
-	return err
+	s.metrics.Written(1)
+	return nil
 }
 
-func (s *SqliteSink) Query(ctx context.Context, query string) ([]map[string]interface{}, error) {
-	return nil, nil
+// Query runs a read only query over the stored events, binding the query
+// parameters to opts.Args.
+func (s *SqliteSink) Query(ctx context.Context, query string, opts sinks.QueryOptions) (*sinks.QueryResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, opts.QueryTimeout())
+	defer cancel()
+
+	if !opts.Since.IsZero() {
+		query = withWindow(query, opts.Since)
+	}
+
+	rows, err := s.reader.QueryContext(ctx, query, opts.Args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	result := sinks.QueryResult{
+		Columns: make([]sinks.Column, 0, len(columnTypes)),
+		Rows:    make([][]interface{}, 0),
+	}
+	for _, columnType := range columnTypes {
+		result.Columns = append(result.Columns, sinks.Column{
+			Name: columnType.Name(),
+			Type: columnType.DatabaseTypeName(),
+		})
+	}
+
+	limit := opts.RowLimit()
+	for rows.Next() {
+		if len(result.Rows) == limit {
+			result.Truncated = true
+			break
+		}
+
+		values := make([]interface{}, len(columnTypes))
+		pointers := make([]interface{}, len(columnTypes))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// withWindow prepends the window table to the query, merging it into the
+// query's own WITH clause if it has one.
+func withWindow(query string, since time.Time) string {
+	table := fmt.Sprintf(windowTable, since.UTC().Format(timeFormat))
+	query = strings.TrimSpace(query)
+	rest, ok := cutKeyword(query, "WITH")
+	if !ok {
+		return "WITH " + table + " " + query
+	}
+	if rest, ok := cutKeyword(rest, "RECURSIVE"); ok {
+		return "WITH RECURSIVE " + table + ", " + rest
+	}
+	return "WITH " + table + ", " + rest
+}
+
+// cutKeyword returns the query after its first word and the spaces
+// following it if the word is the keyword, in any case.
+func cutKeyword(query, keyword string) (string, bool) {
+	end := strings.IndexFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	if end < 0 {
+		end = len(query)
+	}
+	if !strings.EqualFold(query[:end], keyword) {
+		return "", false
+	}
+	return strings.TrimLeftFunc(query[end:], unicode.IsSpace), true
+}
+
+func formatTime(t metav1.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(timeFormat)
+}
+
+// migrateTimestamps rewrites the timestamps stored with the legacy format,
+// which the query windows and the date functions can't compare, with
+// timeFormat.
+func migrateTimestamps(db *sql.DB) error {
+	rows, err := db.Query(`SELECT "uid", CAST("firstTimestamp" AS TEXT), CAST("lastTimestamp" AS TEXT) FROM "events" `+
+		`WHERE length("firstTimestamp") > ? OR length("lastTimestamp") > ?`, len(timeFormat), len(timeFormat))
+	if err != nil {
+		return err
+	}
+
+	type row struct {
+		uid, first, last string
+	}
+	var legacy []row
+	for rows.Next() {
+		var r row
+		var first, last sql.NullString
+		if err := rows.Scan(&r.uid, &first, &last); err != nil {
+			rows.Close()
+			return err
+		}
+		r.first, r.last = migrateTime(first.String), migrateTime(last.String)
+		legacy = append(legacy, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(legacy) == 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, r := range legacy {
+		_, err := tx.Exec(`UPDATE "events" SET "firstTimestamp" = ?, "lastTimestamp" = ? WHERE "uid" = ?`, r.first, r.last, r.uid)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// migrateTime returns the legacy timestamp with timeFormat, other values
+// are returned as is.
+func migrateTime(value string) string {
+	t, err := time.Parse(legacyTimeFormat, value)
+	if err != nil {
+		return value
+	}
+	return formatTime(metav1.NewTime(t))
 }
 
 func (s *SqliteSink) Start(_ context.Context) error {
@@ -72,5 +276,8 @@ func (s *SqliteSink) Start(_ context.Context) error {
 }
 
 func (s *SqliteSink) Stop() error {
+	if err := s.reader.Close(); err != nil {
+		return err
+	}
 	return s.db.Close()
 }
@@ -0,0 +1,88 @@
+package sqliteSink
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithWindow(t *testing.T) {
+	since := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	window := `"events" AS (SELECT * FROM main."events" WHERE "lastTimestamp" >= '2023-01-01 10:00:00')`
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{
+			name:  "plain query",
+			query: `SELECT count(*) FROM events`,
+			want:  `WITH ` + window + ` SELECT count(*) FROM events`,
+		},
+		{
+			name:  "lower case with clause",
+			query: "with counts AS (SELECT 1) SELECT * FROM counts",
+			want:  `WITH ` + window + `, counts AS (SELECT 1) SELECT * FROM counts`,
+		},
+		{
+			name:  "with clause on its own line",
+			query: "WITH\n\tcounts AS (SELECT 1) SELECT * FROM counts",
+			want:  `WITH ` + window + `, counts AS (SELECT 1) SELECT * FROM counts`,
+		},
+		{
+			name:  "recursive with clause",
+			query: "With  Recursive\nn(x) AS (SELECT 1) SELECT x FROM n",
+			want:  `WITH RECURSIVE ` + window + `, n(x) AS (SELECT 1) SELECT x FROM n`,
+		},
+		{
+			name:  "column named like the keyword",
+			query: `SELECT withdrawn FROM events`,
+			want:  `WITH ` + window + ` SELECT withdrawn FROM events`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withWindow(tt.query, since); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMigrateTime(t *testing.T) {
+	tests := map[string]string{
+		"2023-01-01 10:00:00 +0000 UTC": "2023-01-01 10:00:00",
+		"2023-01-01 12:00:00 +0200 EET": "2023-01-01 10:00:00",
+		"0001-01-01 00:00:00 +0000 UTC": "",
+		"2023-01-01 10:00:00":           "2023-01-01 10:00:00",
+	}
+	for value, want := range tests {
+		if got := migrateTime(value); got != want {
+			t.Errorf("expected %q to be migrated to %q, got %q", value, want, got)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.db")
+	sink, err := New(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Stop()
+
+	if err := sink.Probe(context.Background()); err != nil {
+		t.Fatalf("expected the probe to succeed, got %s", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Probe(context.Background()); err == nil {
+		t.Error("expected the probe to fail once the database file is removed")
+	}
+}
@@ -9,56 +9,123 @@ import (
 	"net/http"
 	"time"
 
-	v1 "k8s.io/api/core/v1"
+	"github.com/ahsayde/analytics-controller/internal/sinks"
+	"github.com/ahsayde/analytics-controller/internal/sinks/queue"
+	"github.com/ahsayde/analytics-controller/pkg/events"
 
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+// DeliveryHeader is set on the requests with the update policy the event is
+// delivered under.
+const DeliveryHeader = "X-Event-Delivery"
+
 type WebhookSink struct {
 	endpoint  string
 	headers   map[string]string
-	eventChan chan v1.Event
+	probe     bool
+	queue     queue.Queue
+	deliverer *sinks.Deliverer
+	done      chan struct{}
 	client    http.Client
 }
 
-func New(endpoint string, headers map[string]string) (*WebhookSink, error) {
+func New(endpoint string, headers map[string]string, probe bool, q queue.Queue, deliverer *sinks.Deliverer) (*WebhookSink, error) {
 	return &WebhookSink{
 		endpoint:  endpoint,
 		headers:   headers,
-		eventChan: make(chan v1.Event, 50),
+		probe:     probe,
+		queue:     q,
+		deliverer: deliverer,
+		done:      make(chan struct{}),
 		client:    http.Client{Timeout: time.Duration(5) * time.Second},
 	}, nil
 }
 
+// Probe sends a HEAD request to the endpoint if probing is enabled. Server
+// errors and authentication failures fail the probe, other responses show
+// that the endpoint is reachable.
+func (w *WebhookSink) Probe(ctx context.Context) error {
+	if !w.probe {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, w.endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, value := range w.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach %s: %w", w.endpoint, err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("probe failed with status code: %d", resp.StatusCode)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("probe was denied with status code: %d, check the configured headers", resp.StatusCode)
+	}
+	return nil
+}
+
+// Health returns the delivery health of the sink.
+func (w *WebhookSink) Health() sinks.Health {
+	return w.deliverer.Health()
+}
+
 func (w *WebhookSink) Start(ctx context.Context) error {
 	go w.worker(ctx)
 	return nil
 }
 
+// Stop closes the queue, waits for the events left in memory to be sent and
+// closes the connections.
 func (w *WebhookSink) Stop() error {
+	if err := w.queue.Close(); err != nil {
+		log.Log.Error(err, "failed to close queue")
+	}
+	w.deliverer.Stop()
+	<-w.done
+	if err := w.deliverer.Close(); err != nil {
+		log.Log.Error(err, "failed to close dead-letter target")
+	}
 	w.client.CloseIdleConnections()
 	return nil
 }
 
-func (w *WebhookSink) Write(ctx context.Context, event v1.Event) error {
-	w.eventChan <- event
-	return nil
+func (w *WebhookSink) Write(ctx context.Context, event events.Event) error {
+	return w.queue.Push(ctx, event)
 }
 
 func (w *WebhookSink) worker(ctx context.Context) {
+	defer close(w.done)
 	for {
-		select {
-		case event := <-w.eventChan:
-			if err := w.send(ctx, event); err != nil {
-				log.Log.Error(err, "failed to write event")
-			}
-		case <-ctx.Done():
+		item, err := w.queue.Pop(ctx)
+		if err != nil {
 			return
 		}
+		err = w.deliverer.Deliver(ctx, []events.Event{item.Event}, func(ctx context.Context) error {
+			return w.send(ctx, item.Event)
+		})
+		if err != nil {
+			log.Log.Error(err, "failed to write event")
+			if err := w.queue.Nack(item); err != nil {
+				log.Log.Error(err, "failed to requeue event")
+			}
+			continue
+		}
+		if err := w.queue.Ack(item); err != nil {
+			log.Log.Error(err, "failed to acknowledge event")
+		}
 	}
 }
 
-func (w *WebhookSink) send(ctx context.Context, event v1.Event) error {
+func (w *WebhookSink) send(ctx context.Context, event events.Event) error {
 	data, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal payload: %w", err)
@@ -70,6 +137,7 @@ func (w *WebhookSink) send(ctx context.Context, event v1.Event) error {
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, sinks.Delivery(event))
 	for key, value := range w.headers {
 		req.Header.Set(key, value)
 	}
@@ -78,6 +146,7 @@ func (w *WebhookSink) send(ctx context.Context, event v1.Event) error {
 	if err != nil {
 		return fmt.Errorf("failed to send request: %w", err)
 	}
+	w.deliverer.Metrics().WebhookResponse(resp.StatusCode)
 
 	defer resp.Body.Close()
 
@@ -86,7 +155,11 @@ func (w *WebhookSink) send(ctx context.Context, event v1.Event) error {
 		if err != nil {
 			return fmt.Errorf("failed to response body: %w", err)
 		}
-		return fmt.Errorf("request failed with status code: %d, body: %s", resp.StatusCode, string(body))
+		err = fmt.Errorf("request failed with status code: %d, body: %s", resp.StatusCode, string(body))
+		if sinks.Retryable(resp.StatusCode) {
+			return err
+		}
+		return sinks.Permanent(err)
 	}
 
 	return nil
@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ahsayde/analytics-controller/internal/sinks"
+	"github.com/ahsayde/analytics-controller/internal/sinks/queue"
+)
+
+func newTestSink(t *testing.T, endpoint string, probe bool) *WebhookSink {
+	sink, err := New(endpoint, map[string]string{"Authorization": "Bearer token"}, probe,
+		queue.NewMemory(queue.MemoryOptions{}), sinks.NewDeliverer(sinks.DelivererOptions{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sink.Stop() })
+	return sink
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    bool
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "method not allowed", status: http.StatusMethodNotAllowed},
+		{name: "not found", status: http.StatusNotFound},
+		{name: "unauthorized", status: http.StatusUnauthorized, err: true},
+		{name: "forbidden", status: http.StatusForbidden, err: true},
+		{name: "server error", status: http.StatusServiceUnavailable, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var method, auth string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method, auth = r.Method, r.Header.Get("Authorization")
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			err := newTestSink(t, server.URL, true).Probe(context.Background())
+			if (err != nil) != tt.err {
+				t.Fatalf("got error %v, want error %t", err, tt.err)
+			}
+			if method != http.MethodHead || auth != "Bearer token" {
+				t.Errorf("got %s request with authorization %q", method, auth)
+			}
+		})
+	}
+}
+
+func TestProbeUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	if err := newTestSink(t, server.URL, true).Probe(context.Background()); err == nil {
+		t.Error("expected the probe of a closed server to fail")
+	}
+}
+
+func TestProbeDisabled(t *testing.T) {
+	var probed bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probed = true
+	}))
+	defer server.Close()
+
+	if err := newTestSink(t, server.URL, false).Probe(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if probed {
+		t.Error("expected the endpoint not to be probed")
+	}
+}
@@ -0,0 +1,212 @@
+package watcher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/internal/checkpoint"
+	"github.com/ahsayde/analytics-controller/internal/sinks/queue"
+	"github.com/ahsayde/analytics-controller/pkg/events"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pendingAck is an event pushed to the queue of a sink and not acknowledged
+// yet, identified by its checkpoint.
+type pendingAck struct {
+	seq uint64
+	cp  checkpoint.Checkpoint
+}
+
+// ackTracker advances the checkpoint of a sink delivering its events from a
+// queue as the sink acknowledges them. The checkpoint is only advanced up
+// to the oldest event still waiting to be acknowledged, so that events
+// delivered out of order are never skipped on restart.
+type ackTracker struct {
+	w    *Watcher
+	name string
+	// durable is set if the queue delivers the negatively acknowledged
+	// events again, in-memory queues drop them and they are reported as
+	// dropped instead of holding the checkpoint back.
+	durable bool
+
+	mu      sync.Mutex
+	seq     uint64
+	pending []pendingAck
+	// latest is the checkpoint of the latest acknowledged event.
+	latest checkpoint.Checkpoint
+}
+
+func newAckTracker(w *Watcher, key string, durable bool) *ackTracker {
+	return &ackTracker{
+		w:       w,
+		name:    sinkCheckpoint(key),
+		durable: durable,
+	}
+}
+
+// pushed records the event about to be pushed and returns its sequence
+// number.
+func (t *ackTracker) pushed(event *events.Event) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seq++
+	t.pending = append(t.pending, pendingAck{seq: t.seq, cp: checkpointOf(event)})
+	return t.seq
+}
+
+// discard forgets the event which failed to be pushed.
+func (t *ackTracker) discard(seq uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := len(t.pending) - 1; i >= 0; i-- {
+		if t.pending[i].seq == seq {
+			t.pending = append(t.pending[:i], t.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// acked forgets the event and the ones pushed before it, which were either
+// acknowledged with it or dropped, and advances the checkpoint.
+func (t *ackTracker) acked(event *events.Event) {
+	t.mu.Lock()
+	i := t.index(event)
+	if i < 0 {
+		t.mu.Unlock()
+		return
+	}
+	for _, p := range t.pending[:i+1] {
+		if after(p.cp, t.latest) {
+			t.latest = p.cp
+		}
+	}
+	t.pending = t.pending[i+1:]
+
+	latest := t.latest
+	var oldest time.Time
+	for _, p := range t.pending {
+		if oldest.IsZero() || p.cp.LastTimestamp.Time.Before(oldest) {
+			oldest = p.cp.LastTimestamp.Time
+		}
+	}
+	t.mu.Unlock()
+
+	if !oldest.IsZero() && !oldest.After(latest.LastTimestamp.Time) {
+		// only the events of the seconds before the oldest one waiting to
+		// be acknowledged are known to be delivered.
+		t.w.marks.advanceBefore(t.name, oldest)
+		return
+	}
+	t.w.marks.advanceTo(t.name, latest)
+}
+
+// nacked forgets the event dropped by an in-memory queue and the ones
+// pushed before it, the events of durable queues are delivered again.
+func (t *ackTracker) nacked(event *events.Event) {
+	if t.durable {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if i := t.index(event); i >= 0 {
+		t.pending = t.pending[i+1:]
+	}
+}
+
+// index returns the index of the first pending event matching the event,
+// -1 if there is none such as for the events spooled by a previous run.
+func (t *ackTracker) index(event *events.Event) int {
+	cp := checkpointOf(event)
+	for i, p := range t.pending {
+		if p.cp.UID == cp.UID && p.cp.Count == cp.Count && p.cp.LastTimestamp.Equal(&cp.LastTimestamp) {
+			return i
+		}
+	}
+	return -1
+}
+
+// trackedQueue reports the events pushed to the queue of a sink and the
+// ones it acknowledges to the tracker of its checkpoint.
+type trackedQueue struct {
+	queue.Queue
+	tracker *ackTracker
+}
+
+func (q *trackedQueue) Push(ctx context.Context, event events.Event) error {
+	// recorded first, the event can be acknowledged as soon as it is pushed
+	seq := q.tracker.pushed(&event)
+	if err := q.Queue.Push(ctx, event); err != nil {
+		q.tracker.discard(seq)
+		return err
+	}
+	return nil
+}
+
+func (q *trackedQueue) Ack(item queue.Item) error {
+	if err := q.Queue.Ack(item); err != nil {
+		return err
+	}
+	q.tracker.acked(&item.Event)
+	return nil
+}
+
+func (q *trackedQueue) Nack(item queue.Item) error {
+	if err := q.Queue.Nack(item); err != nil {
+		return err
+	}
+	q.tracker.nacked(&item.Event)
+	return nil
+}
+
+// ackTrackers holds the tracker of each sink delivering from a queue, the
+// checkpoints of the other sinks are advanced once their writes return. It
+// is safe for concurrent use.
+type ackTrackers struct {
+	mu       sync.RWMutex
+	trackers map[string]*ackTracker
+}
+
+func newAckTrackers() *ackTrackers {
+	return &ackTrackers{
+		trackers: make(map[string]*ackTracker),
+	}
+}
+
+// set sets the tracker of the sink registered under the given key, a nil
+// tracker removes it.
+func (a *ackTrackers) set(key string, tracker *ackTracker) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if tracker == nil {
+		delete(a.trackers, key)
+		return
+	}
+	a.trackers[key] = tracker
+}
+
+func (a *ackTrackers) tracked(key string) bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	_, ok := a.trackers[key]
+	return ok
+}
+
+// checkpointOf returns the checkpoint marking the event, checkpoints are
+// persisted with a second precision.
+func checkpointOf(event *events.Event) checkpoint.Checkpoint {
+	return checkpoint.Checkpoint{
+		LastTimestamp: metav1.NewTime(event.LastTimestamp.Time.Truncate(time.Second)),
+		UID:           event.UID,
+		Count:         event.Count,
+	}
+}
+
+// after reports whether the checkpoint marks an event occurring after the
+// one marked by the other.
+func after(cp, other checkpoint.Checkpoint) bool {
+	if !cp.LastTimestamp.Equal(&other.LastTimestamp) {
+		return other.LastTimestamp.Before(&cp.LastTimestamp)
+	}
+	return cp.UID != other.UID || cp.Count > other.Count
+}
@@ -0,0 +1,77 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/internal/checkpoint"
+	"github.com/ahsayde/analytics-controller/pkg/events"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestAckTrackerAdvancesUpToOldestPending(t *testing.T) {
+	w := &Watcher{marks: newHighWaterMarks(nil)}
+	tracker := newAckTracker(w, "sink", false)
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	event := func(uid string, offset time.Duration) *events.Event {
+		return &events.Event{
+			ObjectMeta:    metav1.ObjectMeta{UID: types.UID(uid)},
+			Count:         1,
+			LastTimestamp: metav1.NewTime(base.Add(offset)),
+		}
+	}
+	mark := func() checkpoint.Checkpoint {
+		marks, _ := w.marks.take()
+		return marks[sinkCheckpoint("sink")]
+	}
+
+	newer := event("newer", 10*time.Second)
+	older := event("older", 5*time.Second)
+	latest := event("latest", 20*time.Second)
+	for _, e := range []*events.Event{newer, older, latest} {
+		tracker.pushed(e)
+	}
+
+	tracker.acked(newer)
+	if got := mark(); !got.LastTimestamp.Time.Equal(older.LastTimestamp.Time) || got.UID != "" {
+		t.Errorf("expected the mark to stop before the older pending event, got %+v", got)
+	}
+	if delivered(mark(), older) {
+		t.Error("expected the older pending event not to be delivered")
+	}
+
+	tracker.acked(older)
+	if got := mark(); got.UID != "newer" {
+		t.Errorf("expected the mark to move to the newer event, got %+v", got)
+	}
+
+	seq := tracker.pushed(event("failed", 15*time.Second))
+	tracker.discard(seq)
+	tracker.acked(latest)
+	if got := mark(); got.UID != "latest" {
+		t.Errorf("expected the mark to move to the latest event, got %+v", got)
+	}
+}
+
+func TestAckTrackerNack(t *testing.T) {
+	base := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	dropped := &events.Event{
+		ObjectMeta:    metav1.ObjectMeta{UID: "dropped"},
+		LastTimestamp: metav1.NewTime(base),
+	}
+
+	memory := newAckTracker(&Watcher{marks: newHighWaterMarks(nil)}, "sink", false)
+	memory.pushed(dropped)
+	memory.nacked(dropped)
+	if len(memory.pending) != 0 {
+		t.Error("expected the event dropped by an in-memory queue to be forgotten")
+	}
+
+	durable := newAckTracker(&Watcher{marks: newHighWaterMarks(nil)}, "sink", true)
+	durable.pushed(dropped)
+	durable.nacked(dropped)
+	if len(durable.pending) != 1 {
+		t.Error("expected the event of a durable queue to wait for its redelivery")
+	}
+}
@@ -0,0 +1,198 @@
+package watcher
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/api/v1alpha1"
+	"github.com/ahsayde/analytics-controller/internal/checkpoint"
+	"github.com/ahsayde/analytics-controller/pkg/events"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// watcherCheckpoint is the name of the checkpoint of the latest event
+	// handled by the watcher, used for sinks without a checkpoint.
+	watcherCheckpoint = "watcher"
+	// sinkCheckpointPrefix prefixes the names of the checkpoints of the
+	// latest event written to each sink.
+	sinkCheckpointPrefix = "sink."
+
+	DefaultCheckpointInterval = 30 * time.Second
+
+	checkpointSaveTimeout = 10 * time.Second
+)
+
+// sinkCheckpoint returns the name of the checkpoint of the sink registered
+// under the given key. ConfigMap keys can't contain slashes, the one of
+// namespaced keys is replaced by an underscore, which names can't contain.
+func sinkCheckpoint(key string) string {
+	return sinkCheckpointPrefix + strings.ReplaceAll(key, "/", "_")
+}
+
+// highWaterMarks tracks the latest event handled by name, it is safe for
+// concurrent use.
+type highWaterMarks struct {
+	mu    sync.Mutex
+	marks map[string]checkpoint.Checkpoint
+	dirty bool
+}
+
+func newHighWaterMarks(marks map[string]checkpoint.Checkpoint) *highWaterMarks {
+	if marks == nil {
+		marks = make(map[string]checkpoint.Checkpoint)
+	}
+	return &highWaterMarks{marks: marks}
+}
+
+// advance moves the named mark to the event if it occurred after it.
+func (m *highWaterMarks) advance(name string, event *events.Event) {
+	m.advanceTo(name, checkpointOf(event))
+}
+
+// advanceTo moves the named mark to the checkpoint if it is after it.
+func (m *highWaterMarks) advanceTo(name string, cp checkpoint.Checkpoint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current := m.marks[name]
+	if cp.LastTimestamp.Before(&current.LastTimestamp) {
+		return
+	}
+	if cp.LastTimestamp.Equal(&current.LastTimestamp) && cp.UID == current.UID && cp.Count <= current.Count {
+		return
+	}
+	m.marks[name] = cp
+	m.dirty = true
+}
+
+// advanceBefore moves the named mark to the given second if it is after
+// it, marking the events of the seconds before it only.
+func (m *highWaterMarks) advanceBefore(name string, second time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !second.After(m.marks[name].LastTimestamp.Time) {
+		return
+	}
+	m.marks[name] = checkpoint.Checkpoint{LastTimestamp: metav1.NewTime(second)}
+	m.dirty = true
+}
+
+func (m *highWaterMarks) remove(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.marks[name]; ok {
+		delete(m.marks, name)
+		m.dirty = true
+	}
+}
+
+// take returns a copy of the marks and whether they moved since the last
+// call.
+func (m *highWaterMarks) take() (map[string]checkpoint.Checkpoint, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	marks := make(map[string]checkpoint.Checkpoint, len(m.marks))
+	for name, mark := range m.marks {
+		marks[name] = mark
+	}
+	dirty := m.dirty
+	m.dirty = false
+	return marks, dirty
+}
+
+func (m *highWaterMarks) markDirty() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dirty = true
+}
+
+// delivered reports whether the event was delivered before the checkpoint
+// was taken. Events occurring in the same second as the checkpoint can't be
+// ordered, so they are only considered delivered if they are the
+// checkpointed event itself.
+func delivered(cp checkpoint.Checkpoint, event *events.Event) bool {
+	if cp.IsZero() {
+		return false
+	}
+	last := event.LastTimestamp.Time.Truncate(time.Second)
+	if last.Before(cp.LastTimestamp.Time) {
+		return true
+	}
+	return last.Equal(cp.LastTimestamp.Time) && event.UID == cp.UID && event.Count <= cp.Count
+}
+
+// loadCheckpoints loads the checkpoints persisted by the previous run.
+func (w *Watcher) loadCheckpoints(ctx context.Context) error {
+	if w.opts.Checkpoints == nil {
+		return nil
+	}
+
+	checkpoints, err := w.opts.Checkpoints.Load(ctx)
+	if err != nil {
+		return err
+	}
+
+	w.resumeFrom = checkpoints
+	marks := make(map[string]checkpoint.Checkpoint, len(checkpoints))
+	for name, cp := range checkpoints {
+		marks[name] = cp
+	}
+	w.marks = newHighWaterMarks(marks)
+
+	return nil
+}
+
+// saveCheckpoints persists the high-water marks periodically until the
+// context is done.
+func (w *Watcher) saveCheckpoints(ctx context.Context) {
+	ticker := time.NewTicker(w.opts.CheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.saveCheckpoint(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *Watcher) saveCheckpoint(ctx context.Context) {
+	if w.opts.Checkpoints == nil {
+		return
+	}
+
+	marks, dirty := w.marks.take()
+	if !dirty {
+		return
+	}
+
+	if err := w.opts.Checkpoints.Save(ctx, marks); err != nil {
+		log.Log.Error(err, "failed to save checkpoints")
+		w.marks.markDirty()
+	}
+}
+
+// skipOnStartup reports whether an occurrence is skipped for a sink under
+// the given startup policy. Only added events can be found in the cluster
+// on startup.
+func (w *Watcher) skipOnStartup(o occurrence, policy, sinkName string) bool {
+	if o.kind != eventAdded {
+		return false
+	}
+
+	switch policy {
+	case v1alpha1.SkipStartupPolicy:
+		return o.event.LastTimestamp.Time.Before(w.startedAt)
+	case v1alpha1.SinceCheckpointStartupPolicy:
+		cp, ok := w.resumeFrom[sinkCheckpoint(sinkName)]
+		if !ok {
+			cp = w.resumeFrom[watcherCheckpoint]
+		}
+		return delivered(cp, o.event)
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/ahsayde/analytics-controller/api/v1alpha1"
+	"github.com/ahsayde/analytics-controller/internal/checkpoint"
+	"github.com/ahsayde/analytics-controller/pkg/events"
+)
+
+func newEvent(uid types.UID, last time.Time, count int32) *events.Event {
+	return &events.Event{
+		ObjectMeta:    metav1.ObjectMeta{Name: string(uid), UID: uid},
+		LastTimestamp: metav1.NewTime(last),
+		Count:         count,
+	}
+}
+
+func TestDelivered(t *testing.T) {
+	second := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	cp := checkpoint.Checkpoint{LastTimestamp: metav1.NewTime(second), UID: "a", Count: 2}
+
+	tests := []struct {
+		name  string
+		cp    checkpoint.Checkpoint
+		event *events.Event
+		want  bool
+	}{
+		{name: "no checkpoint", event: newEvent("a", second.Add(-time.Hour), 1)},
+		{name: "earlier second", cp: cp, event: newEvent("b", second.Add(-time.Second), 1), want: true},
+		{name: "later second", cp: cp, event: newEvent("a", second.Add(time.Second), 2)},
+		{name: "checkpointed event", cp: cp, event: newEvent("a", second.Add(500*time.Millisecond), 2), want: true},
+		{name: "earlier count of the checkpointed event", cp: cp, event: newEvent("a", second, 1), want: true},
+		{name: "later count of the checkpointed event", cp: cp, event: newEvent("a", second, 3)},
+		// events of the same second can't be ordered against the checkpoint
+		{name: "other event of the same second", cp: cp, event: newEvent("b", second, 1)},
+		{name: "event of the second of a cap", cp: checkpoint.Checkpoint{LastTimestamp: metav1.NewTime(second)}, event: newEvent("b", second, 1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := delivered(tt.cp, tt.event); got != tt.want {
+				t.Errorf("got delivered %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipOnStartup(t *testing.T) {
+	startedAt := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+	watcherCp := checkpoint.Checkpoint{LastTimestamp: metav1.NewTime(startedAt.Add(-time.Hour))}
+	sinkCp := checkpoint.Checkpoint{LastTimestamp: metav1.NewTime(startedAt.Add(-2 * time.Hour))}
+	w := &Watcher{
+		startedAt: startedAt,
+		resumeFrom: map[string]checkpoint.Checkpoint{
+			watcherCheckpoint:     watcherCp,
+			sinkCheckpoint("out"): sinkCp,
+		},
+	}
+
+	beforeStart := newEvent("a", startedAt.Add(-time.Minute), 1)
+	betweenCheckpoints := newEvent("b", startedAt.Add(-90*time.Minute), 1)
+	beforeCheckpoints := newEvent("c", startedAt.Add(-3*time.Hour), 1)
+	afterStart := newEvent("d", startedAt.Add(time.Minute), 1)
+
+	tests := []struct {
+		name   string
+		policy string
+		sink   string
+		o      occurrence
+		want   bool
+	}{
+		{name: "replay all", policy: v1alpha1.ReplayAllStartupPolicy, sink: "out", o: newOccurrence(beforeCheckpoints, eventAdded, 1)},
+		{name: "skip event found on startup", policy: v1alpha1.SkipStartupPolicy, sink: "out", o: newOccurrence(beforeStart, eventAdded, 1), want: true},
+		{name: "skip new event", policy: v1alpha1.SkipStartupPolicy, sink: "out", o: newOccurrence(afterStart, eventAdded, 1)},
+		{name: "skip updated event", policy: v1alpha1.SkipStartupPolicy, sink: "out", o: newOccurrence(beforeStart, eventUpdated, 1)},
+		{name: "since sink checkpoint", policy: v1alpha1.SinceCheckpointStartupPolicy, sink: "out", o: newOccurrence(betweenCheckpoints, eventAdded, 1)},
+		{name: "before sink checkpoint", policy: v1alpha1.SinceCheckpointStartupPolicy, sink: "out", o: newOccurrence(beforeCheckpoints, eventAdded, 1), want: true},
+		{name: "since watcher checkpoint", policy: v1alpha1.SinceCheckpointStartupPolicy, sink: "new", o: newOccurrence(beforeStart, eventAdded, 1)},
+		{name: "before watcher checkpoint", policy: v1alpha1.SinceCheckpointStartupPolicy, sink: "new", o: newOccurrence(betweenCheckpoints, eventAdded, 1), want: true},
+		{name: "since checkpoint deleted event", policy: v1alpha1.SinceCheckpointStartupPolicy, sink: "out", o: newOccurrence(beforeCheckpoints, eventDeleted, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := w.skipOnStartup(tt.o, tt.policy, tt.sink); got != tt.want {
+				t.Errorf("got skipped %t, want %t", got, tt.want)
+			}
+		})
+	}
+
+	// without any checkpoint every event is delivered
+	empty := &Watcher{startedAt: startedAt}
+	if empty.skipOnStartup(newOccurrence(beforeCheckpoints, eventAdded, 1), v1alpha1.SinceCheckpointStartupPolicy, "out") {
+		t.Error("expected events not to be skipped without checkpoints")
+	}
+}
@@ -0,0 +1,76 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ahsayde/analytics-controller/api/v1alpha1"
+	"github.com/ahsayde/analytics-controller/pkg/events"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// deadLetterQueueSize maximum number of dead letters waiting to be
+// forwarded to their sink.
+const deadLetterQueueSize = 100
+
+// deadLetter is an event forwarded to a dead-letter sink.
+type deadLetter struct {
+	sink  string
+	event events.Event
+}
+
+// sinkDeadLetter forwards the events a sink failed to deliver to another
+// sink. The events are handed over to the watcher rather than written to
+// the sink directly, a sink stopped while the registry is locked would
+// otherwise wait on its own dead letters.
+type sinkDeadLetter struct {
+	source  string
+	target  string
+	letters chan<- deadLetter
+}
+
+func (d *sinkDeadLetter) WriteDeadLetter(_ context.Context, event events.Event, err error) error {
+	// don't bounce the events between sinks failing to deliver them
+	if failed, ok := event.Annotations[v1alpha1.FailedSinkAnnotation]; ok {
+		return fmt.Errorf("event already failed to be delivered to sink %s", failed)
+	}
+
+	letter := deadLetter{sink: d.target, event: *event.DeepCopy()}
+	if letter.event.Annotations == nil {
+		letter.event.Annotations = make(map[string]string)
+	}
+	letter.event.Annotations[v1alpha1.FailedSinkAnnotation] = d.source
+	letter.event.Annotations[v1alpha1.DeliveryErrorAnnotation] = err.Error()
+
+	select {
+	case d.letters <- letter:
+		return nil
+	default:
+		return errors.New("dead-letter queue is full")
+	}
+}
+
+func (d *sinkDeadLetter) Close() error {
+	return nil
+}
+
+// forwardDeadLetters writes the dead letters to their sinks until the
+// context is done.
+func (w *Watcher) forwardDeadLetters(ctx context.Context) {
+	for {
+		select {
+		case letter := <-w.deadLetters:
+			found, err := w.sinks.write(ctx, letter.sink, letter.event)
+			if !found {
+				log.Log.Error(nil, "dead-letter sink not found", "sink", letter.sink)
+				continue
+			}
+			if err != nil {
+				log.Log.Error(err, "failed to write event to dead-letter sink", "sink", letter.sink)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package watcher
+
+import (
+	"sync"
+
+	"github.com/ahsayde/analytics-controller/internal/metrics"
+)
+
+// dropCounters counts the events dropped by each sink since it was first
+// registered, it is safe for concurrent use.
+type dropCounters struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func newDropCounters() *dropCounters {
+	return &dropCounters{
+		counts: make(map[string]int64),
+	}
+}
+
+// onDrop returns the function counting the events dropped by the named sink.
+func (d *dropCounters) onDrop(name string) func() {
+	counter := metrics.SinkDroppedEvents.WithLabelValues(name)
+	return func() {
+		counter.Inc()
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.counts[name]++
+	}
+}
+
+func (d *dropCounters) get(name string) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.counts[name]
+}
+
+func (d *dropCounters) remove(name string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.counts, name)
+	metrics.DeleteSink(name)
+}
@@ -0,0 +1,48 @@
+package watcher
+
+import (
+	"sync"
+
+	"github.com/ahsayde/analytics-controller/internal/expression"
+)
+
+type compiledExpression struct {
+	expr    string
+	program *expression.Program
+	err     error
+}
+
+// expressions caches the compiled expressions of the event sets, they are
+// compiled again when they change. It is safe for concurrent use.
+type expressions struct {
+	mu       sync.Mutex
+	compiled map[string]compiledExpression
+}
+
+func newExpressions() *expressions {
+	return &expressions{
+		compiled: make(map[string]compiledExpression),
+	}
+}
+
+// compile returns the program of the expression of the named event set.
+func (e *expressions) compile(name, expr string) (*expression.Program, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if compiled, ok := e.compiled[name]; ok && compiled.expr == expr {
+		return compiled.program, compiled.err
+	}
+	program, err := expression.Compile(expr)
+	e.compiled[name] = compiledExpression{
+		expr:    expr,
+		program: program,
+		err:     err,
+	}
+	return program, err
+}
+
+func (e *expressions) remove(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.compiled, name)
+}
@@ -0,0 +1,205 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	v1alpha1 "github.com/ahsayde/analytics-controller/api/v1alpha1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	ctrlcache "sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// The selectors of the event filters match the labels of the namespaces
+// and of the involved objects of the label selector kinds, pods by
+// default. Other kinds need their own rules to be added to the role.
+//+kubebuilder:rbac:groups="",resources=namespaces;pods,verbs=get;list;watch
+
+var namespaceKind = v1.SchemeGroupVersion.WithKind("Namespace")
+
+// labelSyncTimeout is how long the label informers have to sync.
+const labelSyncTimeout = 30 * time.Second
+
+// labelInformers starts the metadata only informers of the kinds the
+// selectors of the event sets match, the namespaces and the label selector
+// kinds, when an event set first selects them. The informers are scoped to
+// the watched namespaces by the manager's cache. It is safe for concurrent
+// use.
+type labelInformers struct {
+	mu      sync.RWMutex
+	started map[schema.GroupKind]bool
+	// synced are the kinds the labels are looked up for, the objects of
+	// the other kinds don't match any object selector.
+	synced map[schema.GroupKind]schema.GroupVersionKind
+}
+
+func newLabelInformers() *labelInformers {
+	return &labelInformers{
+		started: make(map[schema.GroupKind]bool),
+		synced:  make(map[schema.GroupKind]schema.GroupVersionKind),
+	}
+}
+
+// watch starts the informer of the kind in the background unless it is
+// already started. A kind whose informer doesn't sync within
+// labelSyncTimeout, for example because the controller isn't allowed to
+// list it, is started again the next time an event set selects it.
+func (l *labelInformers) watch(informers ctrlcache.Informers, gvk schema.GroupVersionKind) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.started[gvk.GroupKind()] {
+		return
+	}
+	l.started[gvk.GroupKind()] = true
+
+	go func() {
+		err := syncInformer(informers, gvk)
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if err != nil {
+			log.Log.Error(err, "failed to watch the labels of kind, selectors won't match its objects", "kind", gvk.String())
+			delete(l.started, gvk.GroupKind())
+			return
+		}
+		l.synced[gvk.GroupKind()] = gvk
+	}()
+}
+
+func syncInformer(informers ctrlcache.Informers, gvk schema.GroupVersionKind) error {
+	ctx, cancel := context.WithTimeout(context.Background(), labelSyncTimeout)
+	defer cancel()
+
+	var obj metav1.PartialObjectMetadata
+	obj.SetGroupVersionKind(gvk)
+	informer, err := informers.GetInformer(ctx, &obj)
+	if err != nil {
+		return err
+	}
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("timed out waiting for the labels to sync")
+	}
+	return nil
+}
+
+func (l *labelInformers) kind(gk schema.GroupKind) (schema.GroupVersionKind, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	gvk, ok := l.synced[gk]
+	return gvk, ok
+}
+
+// WatchLabels starts watching the labels the selectors of the event set
+// match in the background, the selectors don't match the objects of a kind
+// until its labels are synced.
+func (w *Watcher) WatchLabels(spec *v1alpha1.EventSetSpec) {
+	for _, gvk := range selectedKinds(spec, w.opts.LabelSelectorKinds) {
+		w.labels.watch(w.mgr.GetCache(), gvk)
+	}
+}
+
+// selectedKinds returns the kinds whose labels the selectors of the event
+// set match, the namespaces and the label selector kinds of the involved
+// objects its filters with an object selector select.
+func selectedKinds(spec *v1alpha1.EventSetSpec, kinds []schema.GroupVersionKind) []schema.GroupVersionKind {
+	var selected []schema.GroupVersionKind
+	selectsNamespaces := false
+	objectKinds := make(map[string]bool)
+	for _, filter := range append([]v1alpha1.EventFilter{spec.Match}, spec.Exclude...) {
+		if filter.NamespaceSelector != nil {
+			selectsNamespaces = true
+		}
+		if filter.ObjectSelector == nil {
+			continue
+		}
+		if len(filter.Resources) == 0 {
+			objectKinds[""] = true
+		}
+		for _, resource := range filter.Resources {
+			objectKinds[resource.Kind] = true
+		}
+	}
+
+	if selectsNamespaces {
+		selected = append(selected, namespaceKind)
+	}
+	for _, gvk := range kinds {
+		// resources without a kind select the objects of any kind
+		if objectKinds[""] || objectKinds[gvk.Kind] {
+			selected = append(selected, gvk)
+		}
+	}
+	return selected
+}
+
+// labelLookup resolves the labels of the involved objects and namespaces of
+// an event from the synced informers of their kinds, each object is looked
+// up once however many event sets select it.
+type labelLookup struct {
+	ctx       context.Context
+	reader    client.Reader
+	informers *labelInformers
+
+	objects    map[v1.ObjectReference]labels.Set
+	namespaces map[string]labels.Set
+}
+
+func newLabelLookup(ctx context.Context, reader client.Reader, informers *labelInformers) *labelLookup {
+	return &labelLookup{
+		ctx:        ctx,
+		reader:     reader,
+		informers:  informers,
+		objects:    make(map[v1.ObjectReference]labels.Set),
+		namespaces: make(map[string]labels.Set),
+	}
+}
+
+func (l *labelLookup) ObjectLabels(ref v1.ObjectReference) labels.Set {
+	if objectLabels, ok := l.objects[ref]; ok {
+		return objectLabels
+	}
+	var objectLabels labels.Set
+	if ref.Kind != "" && ref.Name != "" {
+		gk := schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind).GroupKind()
+		objectLabels = l.get(gk, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name})
+	}
+	l.objects[ref] = objectLabels
+	return objectLabels
+}
+
+func (l *labelLookup) NamespaceLabels(namespace string) labels.Set {
+	if namespaceLabels, ok := l.namespaces[namespace]; ok {
+		return namespaceLabels
+	}
+	namespaceLabels := l.get(namespaceKind.GroupKind(), client.ObjectKey{Name: namespace})
+	l.namespaces[namespace] = namespaceLabels
+	return namespaceLabels
+}
+
+// get returns the labels of the object, nil if its kind isn't watched. The
+// kinds not synced by the label informers are never read from the cache,
+// which would start and wait for their informer.
+func (l *labelLookup) get(gk schema.GroupKind, key client.ObjectKey) labels.Set {
+	gvk, ok := l.informers.kind(gk)
+	if !ok {
+		return nil
+	}
+
+	var obj metav1.PartialObjectMetadata
+	obj.SetGroupVersionKind(gvk)
+	if err := l.reader.Get(l.ctx, key, &obj); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Log.Error(err, "failed to look up labels", "kind", gvk.String(), "object", key.String())
+		}
+		return nil
+	}
+	return obj.GetLabels()
+}
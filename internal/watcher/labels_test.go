@@ -0,0 +1,62 @@
+package watcher
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/ahsayde/analytics-controller/api/v1alpha1"
+)
+
+func TestSelectedKinds(t *testing.T) {
+	pod := schema.GroupVersionKind{Version: "v1", Kind: "Pod"}
+	deployment := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	kinds := []schema.GroupVersionKind{pod, deployment}
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}}
+
+	tests := []struct {
+		name string
+		spec v1alpha1.EventSetSpec
+		want []schema.GroupVersionKind
+	}{
+		{
+			name: "no selectors",
+			spec: v1alpha1.EventSetSpec{Match: v1alpha1.EventFilter{Reasons: []string{"BackOff"}}},
+		},
+		{
+			name: "namespace selector",
+			spec: v1alpha1.EventSetSpec{Match: v1alpha1.EventFilter{NamespaceSelector: selector}},
+			want: []schema.GroupVersionKind{namespaceKind},
+		},
+		{
+			name: "object selector of any kind",
+			spec: v1alpha1.EventSetSpec{Match: v1alpha1.EventFilter{ObjectSelector: selector}},
+			want: kinds,
+		},
+		{
+			name: "object selector of the resource kinds",
+			spec: v1alpha1.EventSetSpec{Match: v1alpha1.EventFilter{
+				ObjectSelector: selector,
+				Resources:      []v1alpha1.EventResource{{Kind: "Deployment"}, {Kind: "ConfigMap"}},
+			}},
+			want: []schema.GroupVersionKind{deployment},
+		},
+		{
+			name: "exclude filter selectors",
+			spec: v1alpha1.EventSetSpec{Exclude: []v1alpha1.EventFilter{
+				{NamespaceSelector: selector},
+				{ObjectSelector: selector, Resources: []v1alpha1.EventResource{{Kind: "Pod"}}},
+			}},
+			want: []schema.GroupVersionKind{namespaceKind, pod},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectedKinds(&tt.spec, kinds); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/internal/metrics"
+)
+
+// EventSetMatches are the events matched by an event set since the watcher
+// started.
+type EventSetMatches struct {
+	Count     int64
+	LastMatch time.Time
+}
+
+// matchCounters counts the events matched by each event set, it is safe for
+// concurrent use.
+type matchCounters struct {
+	mu      sync.Mutex
+	matches map[string]EventSetMatches
+}
+
+func newMatchCounters() *matchCounters {
+	return &matchCounters{
+		matches: make(map[string]EventSetMatches),
+	}
+}
+
+func (m *matchCounters) matched(name string) {
+	metrics.EventSetMatchedEvents.WithLabelValues(name).Inc()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	matches := m.matches[name]
+	matches.Count++
+	matches.LastMatch = time.Now()
+	m.matches[name] = matches
+}
+
+func (m *matchCounters) get(name string) EventSetMatches {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.matches[name]
+}
+
+func (m *matchCounters) remove(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.matches, name)
+	metrics.DeleteEventSet(name)
+}
@@ -0,0 +1,31 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchCounters(t *testing.T) {
+	m := newMatchCounters()
+	if got := m.get("set"); got.Count != 0 || !got.LastMatch.IsZero() {
+		t.Fatalf("got %+v before any match", got)
+	}
+
+	before := time.Now()
+	m.matched("set")
+	m.matched("set")
+	m.matched(Key("team-a", "set"))
+
+	got := m.get("set")
+	if got.Count != 2 || got.LastMatch.Before(before) {
+		t.Errorf("got %+v, want 2 matches since %s", got, before)
+	}
+	if got := m.get(Key("team-a", "set")); got.Count != 1 {
+		t.Errorf("got %d matches of the namespaced event set, want 1", got.Count)
+	}
+
+	m.remove("set")
+	if got := m.get("set"); got.Count != 0 || !got.LastMatch.IsZero() {
+		t.Errorf("got %+v after the event set was removed", got)
+	}
+}
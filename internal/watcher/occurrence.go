@@ -0,0 +1,83 @@
+package watcher
+
+import (
+	"strconv"
+
+	"github.com/ahsayde/analytics-controller/api/v1alpha1"
+	"github.com/ahsayde/analytics-controller/pkg/events"
+)
+
+type occurrenceKind int
+
+const (
+	eventAdded occurrenceKind = iota
+	eventUpdated
+	eventDeleted
+)
+
+func (k occurrenceKind) String() string {
+	switch k {
+	case eventAdded:
+		return "added"
+	case eventUpdated:
+		return "updated"
+	case eventDeleted:
+		return "deleted"
+	}
+	return "unknown"
+}
+
+// occurrence is an event notification received from the informer.
+type occurrence struct {
+	event *events.Event
+	kind  occurrenceKind
+	// delta is the increase of the event count since the previous
+	// notification of the event.
+	delta int32
+}
+
+func newOccurrence(event *events.Event, kind occurrenceKind, delta int32) occurrence {
+	return occurrence{event: event, kind: kind, delta: delta}
+}
+
+// updateOccurrence returns the occurrence of an updated event, ok is false
+// for resyncs and updates not bumping the count, which are not new
+// occurrences.
+func updateOccurrence(oldEvent, newEvent *events.Event) (o occurrence, ok bool) {
+	if newEvent.Count <= oldEvent.Count {
+		return occurrence{}, false
+	}
+	return newOccurrence(newEvent, eventUpdated, newEvent.Count-oldEvent.Count), true
+}
+
+// deliveredUnder reports whether the occurrence is delivered to the sinks of
+// an event set with the given update policy.
+func (o occurrence) deliveredUnder(policy string) bool {
+	switch policy {
+	case v1alpha1.EveryOccurrenceUpdatePolicy, v1alpha1.CountDeltaUpdatePolicy:
+		return o.kind != eventDeleted
+	case v1alpha1.SummaryUpdatePolicy:
+		return o.kind == eventDeleted
+	default:
+		return o.kind == eventAdded
+	}
+}
+
+// eventFor returns a copy of the event annotated with the update policy it
+// is delivered under.
+func (o occurrence) eventFor(policy string) events.Event {
+	if policy == "" {
+		policy = v1alpha1.FirstOccurrenceUpdatePolicy
+	}
+
+	event := o.event.DeepCopy()
+	if event.Annotations == nil {
+		event.Annotations = make(map[string]string)
+	}
+	event.Annotations[v1alpha1.DeliveryAnnotation] = policy
+	if policy == v1alpha1.CountDeltaUpdatePolicy {
+		event.Annotations[v1alpha1.CountDeltaAnnotation] = strconv.Itoa(int(o.delta))
+	}
+
+	return *event
+}
@@ -0,0 +1,105 @@
+package watcher
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/ahsayde/analytics-controller/api/v1alpha1"
+	"github.com/ahsayde/analytics-controller/pkg/events"
+)
+
+func TestDeliveredUnder(t *testing.T) {
+	tests := []struct {
+		policy  string
+		added   bool
+		updated bool
+		deleted bool
+	}{
+		{policy: "", added: true},
+		{policy: v1alpha1.FirstOccurrenceUpdatePolicy, added: true},
+		{policy: v1alpha1.EveryOccurrenceUpdatePolicy, added: true, updated: true},
+		{policy: v1alpha1.CountDeltaUpdatePolicy, added: true, updated: true},
+		{policy: v1alpha1.SummaryUpdatePolicy, deleted: true},
+	}
+	event := &events.Event{Count: 1}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			for kind, want := range map[occurrenceKind]bool{
+				eventAdded:   tt.added,
+				eventUpdated: tt.updated,
+				eventDeleted: tt.deleted,
+			} {
+				if got := newOccurrence(event, kind, 1).deliveredUnder(tt.policy); got != want {
+					t.Errorf("%s occurrence: got delivered %t, want %t", kind, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEventFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		delivery string
+		delta    string
+	}{
+		{name: "default", policy: "", delivery: v1alpha1.FirstOccurrenceUpdatePolicy},
+		{name: "every occurrence", policy: v1alpha1.EveryOccurrenceUpdatePolicy, delivery: v1alpha1.EveryOccurrenceUpdatePolicy},
+		{name: "count delta", policy: v1alpha1.CountDeltaUpdatePolicy, delivery: v1alpha1.CountDeltaUpdatePolicy, delta: "3"},
+		{name: "summary", policy: v1alpha1.SummaryUpdatePolicy, delivery: v1alpha1.SummaryUpdatePolicy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := &events.Event{
+				ObjectMeta: metav1.ObjectMeta{Name: "event", Annotations: map[string]string{"team": "a"}},
+				Count:      5,
+			}
+			got := newOccurrence(event, eventUpdated, 3).eventFor(tt.policy)
+
+			if got.Annotations[v1alpha1.DeliveryAnnotation] != tt.delivery {
+				t.Errorf("got delivery %q, want %q", got.Annotations[v1alpha1.DeliveryAnnotation], tt.delivery)
+			}
+			delta, ok := got.Annotations[v1alpha1.CountDeltaAnnotation]
+			if delta != tt.delta || ok != (tt.delta != "") {
+				t.Errorf("got count delta %q, want %q", delta, tt.delta)
+			}
+			if got.Annotations["team"] != "a" || got.Count != 5 {
+				t.Errorf("expected the event to be kept, got %+v", got)
+			}
+			if len(event.Annotations) != 1 {
+				t.Error("expected the informer's event not to be annotated")
+			}
+		})
+	}
+}
+
+func TestUpdateOccurrence(t *testing.T) {
+	tests := []struct {
+		name     string
+		oldCount int32
+		newCount int32
+		ok       bool
+		delta    int32
+	}{
+		{name: "count bumped", oldCount: 2, newCount: 3, ok: true, delta: 1},
+		{name: "count bumped several times", oldCount: 2, newCount: 7, ok: true, delta: 5},
+		{name: "resync", oldCount: 3, newCount: 3},
+		{name: "count decreased", oldCount: 3, newCount: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, ok := updateOccurrence(&events.Event{Count: tt.oldCount}, &events.Event{Count: tt.newCount})
+			if ok != tt.ok {
+				t.Fatalf("got ok %t, want %t", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+			if o.kind != eventUpdated || o.delta != tt.delta || o.event.Count != tt.newCount {
+				t.Errorf("got %s occurrence with delta %d of count %d", o.kind, o.delta, o.event.Count)
+			}
+		})
+	}
+}
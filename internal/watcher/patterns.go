@@ -0,0 +1,48 @@
+package watcher
+
+import (
+	"sync"
+
+	v1alpha1 "github.com/ahsayde/analytics-controller/api/v1alpha1"
+)
+
+type compiledPatterns struct {
+	generation int64
+	patterns   *v1alpha1.Patterns
+}
+
+// patterns caches the compiled patterns of the event sets, they are
+// compiled again when their generation changes. It is safe for concurrent
+// use.
+type patterns struct {
+	mu       sync.Mutex
+	compiled map[string]compiledPatterns
+}
+
+func newPatterns() *patterns {
+	return &patterns{
+		compiled: make(map[string]compiledPatterns),
+	}
+}
+
+// compile returns the patterns of the given generation of the named event
+// set.
+func (p *patterns) compile(name string, generation int64, spec *v1alpha1.EventSetSpec) *v1alpha1.Patterns {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if compiled, ok := p.compiled[name]; ok && compiled.generation == generation {
+		return compiled.patterns
+	}
+	compiled := spec.CompilePatterns()
+	p.compiled[name] = compiledPatterns{
+		generation: generation,
+		patterns:   compiled,
+	}
+	return compiled
+}
+
+func (p *patterns) remove(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.compiled, name)
+}
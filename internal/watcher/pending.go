@@ -0,0 +1,114 @@
+package watcher
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ahsayde/analytics-controller/pkg/events"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// PendingEventsPolicy defines what happens to the events matched for a
+// sinkRef while no sink is registered for it.
+type PendingEventsPolicy string
+
+const (
+	// DropPendingEvents drops the events matched for a sinkRef while no sink
+	// is registered for it.
+	DropPendingEvents PendingEventsPolicy = "Drop"
+	// BufferPendingEvents buffers the events matched for a sinkRef while no
+	// sink is registered for it and writes them to the sink once it is, such
+	// as while the sinks are reconciled on startup or a sink fails to start.
+	// The oldest events of a sink are dropped when its buffer is full, and
+	// the events buffered for longer than pendingEventsTTL are dropped, so
+	// that sinkRefs which never resolve don't hold events forever.
+	BufferPendingEvents PendingEventsPolicy = "Buffer"
+
+	DefaultPendingEventsBufferSize = 1000
+
+	// pendingEventsTTL is how long the events stay buffered, longer than
+	// the backoff of the sinks failing to start.
+	pendingEventsTTL = 30 * time.Minute
+)
+
+// pendingEvent is an event matched for a sink before it was registered.
+type pendingEvent struct {
+	o        occurrence
+	event    events.Event
+	buffered time.Time
+}
+
+// pendingEvents buffers the events matched for each sink not registered yet,
+// in a bounded buffer per sink whose events expire after the ttl.
+type pendingEvents struct {
+	mu      sync.Mutex
+	policy  PendingEventsPolicy
+	size    int
+	ttl     time.Duration
+	events  map[string][]pendingEvent
+	dropped map[string]int
+}
+
+func newPendingEvents(policy PendingEventsPolicy, size int) *pendingEvents {
+	if size <= 0 {
+		size = DefaultPendingEventsBufferSize
+	}
+	return &pendingEvents{
+		policy:  policy,
+		size:    size,
+		ttl:     pendingEventsTTL,
+		events:  make(map[string][]pendingEvent),
+		dropped: make(map[string]int),
+	}
+}
+
+// add buffers the event for the sink registered under the given key if the
+// policy allows it, it returns false if the event was dropped.
+func (p *pendingEvents) add(key string, o occurrence, event events.Event) bool {
+	if p.policy != BufferPendingEvents {
+		return false
+	}
+	now := time.Now()
+	p.expire(now)
+
+	buffered := p.events[key]
+	if len(buffered) == p.size {
+		buffered = buffered[1:]
+		p.dropped[key]++
+	}
+	p.events[key] = append(buffered, pendingEvent{o: o, event: event, buffered: now})
+	return true
+}
+
+// expire drops the events buffered before the ttl. The buffers left empty
+// are removed with their dropped counts, which are logged.
+func (p *pendingEvents) expire(now time.Time) {
+	for key, buffered := range p.events {
+		i := 0
+		for i < len(buffered) && now.Sub(buffered[i].buffered) > p.ttl {
+			i++
+		}
+		if i == 0 {
+			continue
+		}
+		p.dropped[key] += i
+		if i < len(buffered) {
+			p.events[key] = buffered[i:]
+			continue
+		}
+		log.Log.Info("dropped expired events buffered for a sink which is not registered", "sink", key, "count", p.dropped[key])
+		delete(p.events, key)
+		delete(p.dropped, key)
+	}
+}
+
+// take empties the buffer of the sink registered under the given key and
+// returns its events and the number of its events dropped since the last
+// call.
+func (p *pendingEvents) take(key string) ([]pendingEvent, int) {
+	p.expire(time.Now())
+	events, dropped := p.events[key], p.dropped[key]
+	delete(p.events, key)
+	delete(p.dropped, key)
+	return events, dropped
+}
@@ -0,0 +1,49 @@
+package watcher
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/ahsayde/analytics-controller/pkg/events"
+)
+
+func TestPendingEventsExpire(t *testing.T) {
+	p := newPendingEvents(BufferPendingEvents, 0)
+	event := events.Event{ObjectMeta: metav1.ObjectMeta{Name: "event"}, Count: 1}
+	o := newOccurrence(&event, eventAdded, 1)
+
+	p.add("never", o, event)
+	p.add("late", o, event)
+	p.add("late", o, event)
+	p.events["never"][0].buffered = time.Now().Add(-2 * p.ttl)
+	p.events["late"][0].buffered = time.Now().Add(-2 * p.ttl)
+
+	// the buffers of the sinkRefs which never resolve expire as events are
+	// buffered for the other ones.
+	p.add("other", o, event)
+	if _, ok := p.events["never"]; ok {
+		t.Error("expected the expired buffer to be removed")
+	}
+	if _, ok := p.dropped["never"]; ok {
+		t.Error("expected the dropped count of the expired buffer to be removed")
+	}
+
+	buffered, dropped := p.take("late")
+	if len(buffered) != 1 || dropped != 1 {
+		t.Errorf("expected 1 buffered and 1 dropped event, got %d and %d", len(buffered), dropped)
+	}
+}
+
+func TestRemoveSinkClearsPendingEvents(t *testing.T) {
+	w := New(nil, Options{})
+	event := events.Event{ObjectMeta: metav1.ObjectMeta{Name: "event"}, Count: 1}
+	w.pending.add("out", newOccurrence(&event, eventAdded, 1), event)
+
+	w.RemoveSink("out")
+
+	if buffered, _ := w.pending.take("out"); len(buffered) != 0 {
+		t.Errorf("expected the buffer of the removed sink to be cleared, got %d events", len(buffered))
+	}
+}
@@ -0,0 +1,241 @@
+package watcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/ahsayde/analytics-controller/api/v1alpha1"
+	"github.com/ahsayde/analytics-controller/pkg/events"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+type registryEntry struct {
+	sink Sink
+	// hash of the spec and secret config the sink was created from.
+	hash string
+	// start starts a sink again from the config the sink was created from,
+	// nil if it can't be.
+	start func() (Sink, error)
+	// writers counts the writes in progress to the sink.
+	writers sync.WaitGroup
+	// replacing is set on the entry holding the name of a sink while it is
+	// replaced by replace, and closed once it is.
+	replacing chan struct{}
+}
+
+// registry holds the registered sinks, it is safe for concurrent use. The
+// lock is never held while writing to, starting or stopping a sink, so a
+// slow sink doesn't hold back the others. Writes in progress are waited for
+// once a sink is unregistered, so when swap or remove return no write can
+// reach the replaced sink anymore and it can be stopped safely. A name is
+// only ever swapped or replaced by one caller at a time, the reconciler of
+// the sink.
+type registry struct {
+	mu      sync.RWMutex
+	entries map[string]*registryEntry
+}
+
+func newRegistry() *registry {
+	return &registry{
+		entries: make(map[string]*registryEntry),
+	}
+}
+
+func (r *registry) get(name string) (Sink, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.entries[name]
+	if !ok || entry.replacing != nil {
+		return nil, false
+	}
+	return entry.sink, true
+}
+
+// has reports whether a sink is registered under the given name, including
+// while it is replaced.
+func (r *registry) has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.entries[name]
+	return ok
+}
+
+func (r *registry) hash(name string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	entry, ok := r.entries[name]
+	if !ok {
+		return "", false
+	}
+	return entry.hash, true
+}
+
+func (r *registry) len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.entries)
+}
+
+// write writes the event to the named sink, found is false if there is no
+// sink registered with that name. Writes to a sink being replaced wait for
+// its replacement.
+func (r *registry) write(ctx context.Context, name string, event events.Event) (found bool, err error) {
+	for {
+		r.mu.RLock()
+		entry, ok := r.entries[name]
+		if ok && entry.replacing == nil {
+			entry.writers.Add(1)
+		}
+		r.mu.RUnlock()
+
+		if !ok {
+			return false, nil
+		}
+		if entry.replacing == nil {
+			defer entry.writers.Done()
+			return true, entry.sink.Write(ctx, event)
+		}
+
+		select {
+		case <-entry.replacing:
+		case <-ctx.Done():
+			return true, ctx.Err()
+		}
+	}
+}
+
+// swap registers the sink under the given name and returns the sink it
+// replaced, if any, once no write to it is in progress. start starts the
+// sink again if it is replaced by replace and its replacement fails.
+func (r *registry) swap(name, hash string, sink Sink, start func() (Sink, error)) (Sink, bool) {
+	r.mu.Lock()
+	old, ok := r.entries[name]
+	r.entries[name] = &registryEntry{sink: sink, hash: hash, start: start}
+	r.mu.Unlock()
+
+	if !ok || old.replacing != nil {
+		return nil, false
+	}
+	old.writers.Wait()
+	return old.sink, true
+}
+
+// replace stops the sink registered under the given name, if any, before
+// creating the sink replacing it, for the sinks which can't run side by
+// side such as the ones sharing a spool. Writes to the sink wait for its
+// replacement in between, so none of them misses it. If the replacement
+// fails to be created the replaced sink is started again.
+func (r *registry) replace(name, hash string, create, start func() (Sink, error)) error {
+	placeholder := &registryEntry{replacing: make(chan struct{})}
+	defer close(placeholder.replacing)
+
+	r.mu.Lock()
+	old, ok := r.entries[name]
+	if ok {
+		placeholder.hash = old.hash
+		r.entries[name] = placeholder
+	}
+	r.mu.Unlock()
+
+	if ok {
+		old.writers.Wait()
+		if err := old.sink.Stop(); err != nil {
+			log.Log.Error(err, "failed to stop replaced sink", "sink", name)
+		}
+	}
+
+	sink, err := create()
+	if err != nil {
+		if !ok || old.start == nil {
+			r.unregister(name, placeholder)
+			return err
+		}
+		restored, restoreErr := old.start()
+		if restoreErr != nil {
+			log.Log.Error(restoreErr, "failed to restore replaced sink", "sink", name)
+			r.unregister(name, placeholder)
+			return err
+		}
+		r.register(name, placeholder, &registryEntry{sink: restored, hash: old.hash, start: old.start})
+		return err
+	}
+	r.register(name, placeholder, &registryEntry{sink: sink, hash: hash, start: start})
+	return nil
+}
+
+// register registers the entry in place of the placeholder, its sink is
+// stopped if the placeholder was removed meanwhile.
+func (r *registry) register(name string, placeholder, entry *registryEntry) {
+	r.mu.Lock()
+	registered := r.entries[name] == placeholder
+	if registered {
+		r.entries[name] = entry
+	}
+	r.mu.Unlock()
+
+	if !registered {
+		if err := entry.sink.Stop(); err != nil {
+			log.Log.Error(err, "failed to stop removed sink", "sink", name)
+		}
+	}
+}
+
+// unregister removes the placeholder registered under the given name.
+func (r *registry) unregister(name string, placeholder *registryEntry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.entries[name] == placeholder {
+		delete(r.entries, name)
+	}
+}
+
+// remove unregisters the named sink and returns it once no write to it is
+// in progress.
+func (r *registry) remove(name string) (Sink, bool) {
+	r.mu.Lock()
+	entry, ok := r.entries[name]
+	delete(r.entries, name)
+	r.mu.Unlock()
+
+	if !ok || entry.replacing != nil {
+		return nil, false
+	}
+	entry.writers.Wait()
+	return entry.sink, true
+}
+
+// removeAll empties the registry and returns the sinks it held once no
+// write to them is in progress.
+func (r *registry) removeAll() map[string]Sink {
+	r.mu.Lock()
+	entries := r.entries
+	r.entries = make(map[string]*registryEntry)
+	r.mu.Unlock()
+
+	sinks := make(map[string]Sink, len(entries))
+	for name, entry := range entries {
+		if entry.replacing != nil {
+			continue
+		}
+		entry.writers.Wait()
+		sinks[name] = entry.sink
+	}
+	return sinks
+}
+
+// sinkHash returns a hash of the config a sink is created from, used to
+// detect whether a reconciled sink has to be recreated.
+func sinkHash(spec v1alpha1.SinkSpec, secretConf map[string]string) (string, error) {
+	data, err := json.Marshal(struct {
+		Spec       v1alpha1.SinkSpec `json:"spec"`
+		SecretConf map[string]string `json:"secretConf"`
+	}{spec, secretConf})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,341 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ahsayde/analytics-controller/api/v1alpha1"
+	"github.com/ahsayde/analytics-controller/pkg/events"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeSink fails the test if it is written to after being stopped.
+type fakeSink struct {
+	t       *testing.T
+	stopped int32
+	writes  int32
+}
+
+func (s *fakeSink) Write(_ context.Context, _ events.Event) error {
+	if atomic.LoadInt32(&s.stopped) == 1 {
+		s.t.Error("write to a stopped sink")
+	}
+	atomic.AddInt32(&s.writes, 1)
+	return nil
+}
+
+func (s *fakeSink) Start(_ context.Context) error {
+	return nil
+}
+
+func (s *fakeSink) Stop() error {
+	if !atomic.CompareAndSwapInt32(&s.stopped, 0, 1) {
+		s.t.Error("sink stopped twice")
+	}
+	return nil
+}
+
+func TestRegistrySwap(t *testing.T) {
+	r := newRegistry()
+	first := &fakeSink{t: t}
+	second := &fakeSink{t: t}
+
+	if _, ok := r.swap("sink", "a", first, nil); ok {
+		t.Fatal("expected no previous sink")
+	}
+
+	old, ok := r.swap("sink", "b", second, nil)
+	if !ok || old != first {
+		t.Fatalf("expected the first sink to be replaced, got %v", old)
+	}
+
+	if hash, _ := r.hash("sink"); hash != "b" {
+		t.Errorf("expected hash b, got %s", hash)
+	}
+
+	if found, err := r.write(context.Background(), "sink", events.Event{}); !found || err != nil {
+		t.Fatalf("expected write to succeed, found: %v, err: %v", found, err)
+	}
+	if second.writes != 1 || first.writes != 0 {
+		t.Errorf("expected the write to reach the second sink only")
+	}
+
+	if found, _ := r.write(context.Background(), "missing", events.Event{}); found {
+		t.Error("expected missing sink not to be found")
+	}
+}
+
+func TestRegistryConcurrentAccess(t *testing.T) {
+	r := newRegistry()
+	ctx := context.Background()
+	names := []string{"a", "b", "c"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				for _, name := range names {
+					_, _ = r.write(ctx, name, events.Event{})
+					_, _ = r.get(name)
+				}
+				_ = r.len()
+			}
+		}()
+	}
+
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if old, ok := r.swap(name, fmt.Sprint(j), &fakeSink{t: t}, nil); ok {
+					_ = old.Stop()
+				}
+				if j%10 == 0 {
+					if old, ok := r.remove(name); ok {
+						_ = old.Stop()
+					}
+				}
+			}
+		}(name)
+	}
+
+	wg.Wait()
+
+	for _, sink := range r.removeAll() {
+		_ = sink.Stop()
+	}
+	if r.len() != 0 {
+		t.Errorf("expected empty registry, got %d sinks", r.len())
+	}
+}
+
+func TestRegistryReplaceRestoresOnFailure(t *testing.T) {
+	r := newRegistry()
+	first := &fakeSink{t: t}
+	restored := &fakeSink{t: t}
+	r.swap("sink", "a", first, func() (Sink, error) {
+		return restored, nil
+	})
+
+	err := r.replace("sink", "b", func() (Sink, error) {
+		if atomic.LoadInt32(&first.stopped) == 0 {
+			t.Error("expected the replaced sink to be stopped first")
+		}
+		return nil, fmt.Errorf("probe failed")
+	}, nil)
+	if err == nil {
+		t.Fatal("expected the replacement to fail")
+	}
+
+	if current, _ := r.get("sink"); current != restored {
+		t.Fatalf("expected the replaced sink to be restored, got %v", current)
+	}
+	if hash, _ := r.hash("sink"); hash != "a" {
+		t.Errorf("expected hash a, got %s", hash)
+	}
+	if found, err := r.write(context.Background(), "sink", events.Event{}); !found || err != nil {
+		t.Fatalf("expected write to succeed, found: %v, err: %v", found, err)
+	}
+	if restored.writes != 1 {
+		t.Error("expected the write to reach the restored sink")
+	}
+}
+
+func TestRegistryWriteWaitsForReplacement(t *testing.T) {
+	r := newRegistry()
+	r.swap("sink", "a", &fakeSink{t: t}, nil)
+	second := &fakeSink{t: t}
+
+	creating := make(chan struct{})
+	created := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- r.replace("sink", "b", func() (Sink, error) {
+			close(creating)
+			<-created
+			return second, nil
+		}, nil)
+	}()
+
+	<-creating
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		if found, err := r.write(context.Background(), "sink", events.Event{}); !found || err != nil {
+			t.Errorf("expected write to succeed, found: %v, err: %v", found, err)
+		}
+	}()
+	// other sinks aren't held back by the replacement
+	r.swap("other", "", &fakeSink{t: t}, nil)
+	if found, _ := r.write(context.Background(), "other", events.Event{}); !found {
+		t.Error("expected the other sink to be found")
+	}
+
+	close(created)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	<-written
+	if second.writes != 1 {
+		t.Error("expected the write to reach the replacement")
+	}
+}
+
+func TestRegisterSinkReplacesOnSpecChange(t *testing.T) {
+	w := &Watcher{
+		sinks:   newRegistry(),
+		pending: newPendingEvents(DropPendingEvents, 0),
+		marks:   newHighWaterMarks(nil),
+		acks:    newAckTrackers(),
+		drops:   newDropCounters(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	cr := v1alpha1.Sink{
+		ObjectMeta: metav1.ObjectMeta{Name: "file"},
+		Spec: v1alpha1.SinkSpec{
+			File: &v1alpha1.FileSink{Path: filepath.Join(dir, "events.json")},
+		},
+	}
+
+	if err := w.RegisterSink(ctx, cr, nil); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := w.GetSink("file")
+
+	if err := w.RegisterSink(ctx, cr, nil); err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := w.GetSink("file"); current != first {
+		t.Error("expected unchanged sink to be kept")
+	}
+
+	cr.Spec.File.Path = filepath.Join(dir, "other.json")
+	if err := w.RegisterSink(ctx, cr, nil); err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := w.GetSink("file"); current == first {
+		t.Error("expected sink to be replaced after spec change")
+	}
+
+	w.RemoveSink("file")
+	if _, ok := w.GetSink("file"); ok {
+		t.Error("expected sink to be removed")
+	}
+}
+
+func TestRegisterNamespacedSinkRejectsForbiddenFields(t *testing.T) {
+	w := &Watcher{
+		sinks:   newRegistry(),
+		pending: newPendingEvents(DropPendingEvents, 0),
+		marks:   newHighWaterMarks(nil),
+		acks:    newAckTrackers(),
+		drops:   newDropCounters(),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cr := v1alpha1.NamespacedSink{
+		ObjectMeta: metav1.ObjectMeta{Name: "file", Namespace: "team-a"},
+		Spec: v1alpha1.SinkSpec{
+			File: &v1alpha1.FileSink{Path: filepath.Join(t.TempDir(), "events.json")},
+		},
+	}
+	if err := w.RegisterNamespacedSink(ctx, cr, nil); err == nil {
+		t.Fatal("expected namespaced file sink to be rejected")
+	}
+	if _, ok := w.GetSink(Key("team-a", "file")); ok {
+		t.Error("expected rejected sink not to be registered")
+	}
+}
+
+func TestDeliverResolvesSinkRefsInNamespace(t *testing.T) {
+	w := &Watcher{
+		sinks:       newRegistry(),
+		pending:     newPendingEvents(DropPendingEvents, 0),
+		marks:       newHighWaterMarks(nil),
+		acks:        newAckTrackers(),
+		matches:     newMatchCounters(),
+		expressions: newExpressions(),
+		patterns:    newPatterns(),
+	}
+	cluster := &fakeSink{t: t}
+	tenant := &fakeSink{t: t}
+	w.sinks.swap("out", "", cluster, nil)
+	w.sinks.swap(Key("team-a", "out"), "", tenant, nil)
+
+	event := &events.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: "event", Namespace: "team-a"},
+		Count:      1,
+	}
+	spec := &v1alpha1.EventSetSpec{
+		SinkRefs: []v1.LocalObjectReference{{Name: "out"}},
+	}
+	w.deliver(context.Background(), newOccurrence(event, eventAdded, 1), nil, nil, Key("team-a", "events"), "team-a", 1, spec)
+
+	if tenant.writes != 1 || cluster.writes != 0 {
+		t.Errorf("expected the event to reach the namespaced sink only, got %d namespaced and %d cluster writes", tenant.writes, cluster.writes)
+	}
+	if got := w.EventSetMatches(Key("team-a", "events")).Count; got != 1 {
+		t.Errorf("expected 1 match, got %d", got)
+	}
+	marks, _ := w.marks.take()
+	if _, ok := marks[sinkCheckpoint(Key("team-a", "out"))]; !ok {
+		t.Error("expected a checkpoint for the namespaced sink")
+	}
+}
+
+func TestDeliverBuffersEventsOfUnregisteredSinks(t *testing.T) {
+	w := &Watcher{
+		sinks:       newRegistry(),
+		pending:     newPendingEvents(BufferPendingEvents, 0),
+		marks:       newHighWaterMarks(nil),
+		acks:        newAckTrackers(),
+		matches:     newMatchCounters(),
+		expressions: newExpressions(),
+		patterns:    newPatterns(),
+	}
+	registered := &fakeSink{t: t}
+	w.sinks.swap("registered", "", registered, nil)
+
+	event := &events.Event{
+		ObjectMeta: metav1.ObjectMeta{Name: "event", Namespace: "default"},
+		Count:      1,
+	}
+	spec := &v1alpha1.EventSetSpec{
+		SinkRefs: []v1.LocalObjectReference{{Name: "registered"}, {Name: "late"}},
+	}
+	w.deliver(context.Background(), newOccurrence(event, eventAdded, 1), nil, nil, "events", "", 1, spec)
+	if registered.writes != 1 {
+		t.Errorf("expected the event to reach the registered sink, got %d writes", registered.writes)
+	}
+
+	late := &fakeSink{t: t}
+	w.sinks.swap("late", "", late, nil)
+	w.flushPending(context.Background(), "late")
+	if late.writes != 1 {
+		t.Errorf("expected the buffered event to reach the sink once registered, got %d writes", late.writes)
+	}
+	if registered.writes != 1 {
+		t.Error("expected the registered sink not to get the event again")
+	}
+}
+
+func TestSinkCheckpointOfNamespacedSink(t *testing.T) {
+	if got := sinkCheckpoint(Key("team-a", "out")); got != "sink.team-a_out" {
+		t.Errorf("expected sink.team-a_out, got %s", got)
+	}
+	if got := sinkCheckpoint("out"); got != "sink.out" {
+		t.Errorf("expected sink.out, got %s", got)
+	}
+}
@@ -3,11 +3,30 @@ package watcher
 import (
 	"context"
 
-	v1 "k8s.io/api/core/v1"
+	"github.com/ahsayde/analytics-controller/internal/sinks"
+	"github.com/ahsayde/analytics-controller/pkg/events"
 )
 
 type Sink interface {
-	Write(ctx context.Context, event v1.Event) error
+	Write(ctx context.Context, event events.Event) error
 	Start(ctx context.Context) error
 	Stop() error
 }
+
+// QueryableSink is implemented by sinks that can run queries over the
+// events they store.
+type QueryableSink interface {
+	Sink
+	Query(ctx context.Context, query string, opts sinks.QueryOptions) (*sinks.QueryResult, error)
+}
+
+// Prober is implemented by the sinks that can check their backend is
+// reachable and correctly configured before they are started.
+type Prober interface {
+	Probe(ctx context.Context) error
+}
+
+// HealthReporter is implemented by the sinks tracking their delivery health.
+type HealthReporter interface {
+	Health() sinks.Health
+}
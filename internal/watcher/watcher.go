@@ -2,139 +2,708 @@ package watcher
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/ahsayde/analytics-controller/api/v1alpha1"
+	"github.com/ahsayde/analytics-controller/internal/checkpoint"
+	"github.com/ahsayde/analytics-controller/internal/expression"
+	"github.com/ahsayde/analytics-controller/internal/metrics"
+	"github.com/ahsayde/analytics-controller/internal/sinks"
 	elasticSink "github.com/ahsayde/analytics-controller/internal/sinks/elastic"
 	fileSink "github.com/ahsayde/analytics-controller/internal/sinks/file"
+	"github.com/ahsayde/analytics-controller/internal/sinks/queue"
 	sqliteSink "github.com/ahsayde/analytics-controller/internal/sinks/sqlite"
 	webhookSink "github.com/ahsayde/analytics-controller/internal/sinks/webhook"
+	"github.com/ahsayde/analytics-controller/pkg/events"
 
-	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/tools/cache"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+//+kubebuilder:rbac:groups="";events.k8s.io,resources=events,verbs=get;list;watch
+
+// probeTimeout is how long sinks have to probe their backend.
+const probeTimeout = 10 * time.Second
+
+var (
+	ErrSinkNotFound     = errors.New("sink is not registered")
+	ErrSinkNotQueryable = errors.New("sink does not support queries")
+)
+
+type Options struct {
+	// PendingEventsPolicy defines what happens to the events matched for a
+	// sinkRef while no sink is registered for it, defaults to
+	// BufferPendingEvents.
+	PendingEventsPolicy PendingEventsPolicy
+
+	// PendingEventsBufferSize maximum number of pending events buffered for
+	// each sink.
+	PendingEventsBufferSize int
+
+	// StartupPolicy defines which of the events found in the cluster on
+	// startup are delivered for the event sets not setting their own,
+	// defaults to ReplayAll.
+	StartupPolicy string
+
+	// Checkpoints stores the checkpoint the SinceCheckpoint startup policy
+	// resumes from, checkpoints are disabled if nil.
+	Checkpoints *checkpoint.Store
+
+	// CheckpointInterval interval between checkpoint saves.
+	CheckpointInterval time.Duration
+
+	// EventsAPIVersion API version the events are watched with, v1 or
+	// events.k8s.io/v1, defaults to v1. Both serve the same events, so only
+	// one of them is watched.
+	EventsAPIVersion string
+
+	// Namespaces the events are watched in, all namespaces if empty. The
+	// manager's cache must be restricted to the same namespaces.
+	Namespaces []string
+
+	// LabelSelectorKinds kinds of the involved objects the object
+	// selectors of the event sets match, their metadata is cached once an
+	// event set selects them. The objects of the other kinds never match an
+	// object selector.
+	LabelSelectorKinds []schema.GroupVersionKind
+}
+
 type Watcher struct {
-	mgr   ctrl.Manager
-	sinks map[string]Sink
+	mgr     ctrl.Manager
+	opts    Options
+	sinks   *registry
+	pending *pendingEvents
+
+	// startedAt is the time the watcher started, events that last occurred
+	// before it were found in the cluster on startup.
+	startedAt time.Time
+	// resumeFrom are the checkpoints persisted by the previous run.
+	resumeFrom map[string]checkpoint.Checkpoint
+	// marks are the latest events handled by the watcher and delivered by
+	// each sink.
+	marks *highWaterMarks
+	// acks track the events delivered by the sinks with a queue.
+	acks *ackTrackers
+	// drops counts the events dropped by the sink queues.
+	drops *dropCounters
+	// matches counts the events matched by the event sets.
+	matches *matchCounters
+	// expressions are the compiled expressions of the event sets.
+	expressions *expressions
+	// patterns are the compiled patterns of the event sets.
+	patterns *patterns
+	// deadLetters are the events waiting to be forwarded to dead-letter
+	// sinks.
+	deadLetters chan deadLetter
+	// labels are the informers of the labels matched by the selectors.
+	labels *labelInformers
 }
 
-func New(mgr ctrl.Manager) *Watcher {
+func New(mgr ctrl.Manager, opts Options) *Watcher {
+	if opts.PendingEventsPolicy == "" {
+		opts.PendingEventsPolicy = BufferPendingEvents
+	}
+	if opts.StartupPolicy == "" {
+		opts.StartupPolicy = v1alpha1.ReplayAllStartupPolicy
+	}
+	if opts.CheckpointInterval <= 0 {
+		opts.CheckpointInterval = DefaultCheckpointInterval
+	}
+	if opts.EventsAPIVersion == "" {
+		opts.EventsAPIVersion = events.CoreV1
+	}
 	return &Watcher{
-		mgr:   mgr,
-		sinks: make(map[string]Sink),
+		mgr:     mgr,
+		opts:    opts,
+		sinks:   newRegistry(),
+		pending: newPendingEvents(opts.PendingEventsPolicy, opts.PendingEventsBufferSize),
+		marks:   newHighWaterMarks(nil),
+		acks:    newAckTrackers(),
+		drops:   newDropCounters(),
+		matches: newMatchCounters(),
+
+		expressions: newExpressions(),
+		patterns:    newPatterns(),
+
+		deadLetters: make(chan deadLetter, deadLetterQueueSize),
+		labels:      newLabelInformers(),
 	}
 }
 
 func (w *Watcher) Start(ctx context.Context) error {
-	informer, err := w.mgr.GetCache().GetInformer(ctx, &v1.Event{})
-	if err != nil {
+	w.startedAt = time.Now()
+
+	if err := w.loadCheckpoints(ctx); err != nil {
 		return err
 	}
 
-	log.Log.Info("watting for sinks to be registered ...")
-
-	for len(w.sinks) == 0 {
-		time.Sleep(1 * time.Second)
+	obj, err := events.NewObject(w.opts.EventsAPIVersion)
+	if err != nil {
+		return err
+	}
+	informer, err := w.mgr.GetCache().GetInformer(ctx, obj)
+	if err != nil {
+		return err
 	}
 
-	log.Log.Info("starting events listener ...")
+	go w.saveCheckpoints(ctx)
+	go w.forwardDeadLetters(ctx)
+
+	log.Log.Info("starting events listener ...", "apiVersion", w.opts.EventsAPIVersion, "namespaces", w.opts.Namespaces)
 
 	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
-			w.handler(ctx, obj)
+			event, ok := events.FromObject(obj)
+			if !ok {
+				return
+			}
+			w.handler(ctx, newOccurrence(event, eventAdded, event.Count))
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldEvent, ok := events.FromObject(oldObj)
+			if !ok {
+				return
+			}
+			newEvent, ok := events.FromObject(newObj)
+			if !ok {
+				return
+			}
+			if o, ok := updateOccurrence(oldEvent, newEvent); ok {
+				w.handler(ctx, o)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			event, ok := events.FromObject(obj)
+			if !ok {
+				return
+			}
+			w.handler(ctx, newOccurrence(event, eventDeleted, 0))
 		},
 	})
 
 	<-ctx.Done()
 
-	for name, sink := range w.sinks {
+	log.Log.Info("stopping events listener ...")
+
+	for name, sink := range w.sinks.removeAll() {
 		if err := sink.Stop(); err != nil {
 			log.Log.Error(err, "failed to stop sink", "sink", name)
 		}
 	}
 
+	saveCtx, cancel := context.WithTimeout(context.Background(), checkpointSaveTimeout)
+	defer cancel()
+	w.saveCheckpoint(saveCtx)
+
 	return nil
 }
 
-func (w *Watcher) handler(ctx context.Context, obj interface{}) {
-	event, ok := obj.(*v1.Event)
-	if !ok {
+func (w *Watcher) handler(ctx context.Context, o occurrence) {
+	if ctx.Err() != nil {
 		return
 	}
+	metrics.WatcherEvents.WithLabelValues(o.kind.String()).Inc()
+
+	w.dispatch(ctx, o)
+}
+
+// flushPending writes the events matched for the sink registered under the
+// given key before it was registered.
+func (w *Watcher) flushPending(ctx context.Context, key string) {
+	w.pending.mu.Lock()
+	pending, dropped := w.pending.take(key)
+	w.pending.mu.Unlock()
+
+	if dropped > 0 {
+		log.Log.Info("dropped events received while the sink was not registered", "sink", key, "count", dropped)
+	}
+
+	for _, p := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		w.write(ctx, p.o, key, p.event)
+	}
+}
 
+func (w *Watcher) dispatch(ctx context.Context, o occurrence) {
 	var eventSets v1alpha1.EventSetList
 	if err := w.mgr.GetCache().List(ctx, &eventSets); err != nil {
 		log.Log.Error(err, "failed to list event sets")
 		return
 	}
+	var namespacedEventSets v1alpha1.NamespacedEventSetList
+	if err := w.mgr.GetCache().List(ctx, &namespacedEventSets, client.InNamespace(o.event.Namespace)); err != nil {
+		log.Log.Error(err, "failed to list namespaced event sets")
+		return
+	}
+
+	if o.kind != eventDeleted {
+		defer w.marks.advance(watcherCheckpoint, o.event)
+	}
 
-	for _, eventSet := range eventSets.Items {
-		if eventSet.Spec.Match.Match(event) {
-			for _, ref := range eventSet.Spec.SinkRefs {
-				sink, ok := w.sinks[ref.Name]
-				if !ok {
-					log.Log.Error(nil, "sink not found", "sink", ref.Name)
-					continue
-				}
-				if err := sink.Write(ctx, *event); err != nil {
-					log.Log.Error(err, "failed to write event to sink", "sink", ref.Name)
-				}
+	input := expression.NewInput(o.event)
+	lookup := newLabelLookup(ctx, w.mgr.GetCache(), w.labels)
+
+	for i := range eventSets.Items {
+		eventSet := &eventSets.Items[i]
+		w.deliver(ctx, o, input, lookup, eventSet.Name, "", eventSet.Generation, &eventSet.Spec)
+	}
+	for i := range namespacedEventSets.Items {
+		eventSet := &namespacedEventSets.Items[i]
+		// tenants never get the events of other namespaces, whatever the
+		// namespaces of their event sets are.
+		if eventSet.Namespace == "" || eventSet.Namespace != o.event.Namespace {
+			continue
+		}
+		w.deliver(ctx, o, input, lookup, Key(eventSet.Namespace, eventSet.Name), eventSet.Namespace, eventSet.Generation, &eventSet.Spec)
+	}
+}
+
+// deliver writes the occurrence to the sinks of the event set registered
+// under the given key if it matches. The sinkRefs of namespaced event sets
+// only resolve to the sinks of their namespace. The patterns are compiled
+// once per generation of the event set.
+func (w *Watcher) deliver(ctx context.Context, o occurrence, input *expression.Input, lookup *labelLookup, key, namespace string, generation int64, spec *v1alpha1.EventSetSpec) {
+	if !o.deliveredUnder(spec.UpdatePolicy) {
+		return
+	}
+	if !spec.Matches(o.event, lookup, w.patterns.compile(key, generation, spec)) || !w.matchExpression(key, spec.Expression, input) {
+		return
+	}
+
+	startupPolicy := spec.StartupPolicy
+	if startupPolicy == "" {
+		startupPolicy = w.opts.StartupPolicy
+	}
+
+	w.matches.matched(key)
+	event := o.eventFor(spec.UpdatePolicy)
+	for _, ref := range spec.SinkRefs {
+		sinkKey := Key(namespace, ref.Name)
+		if w.skipOnStartup(o, startupPolicy, sinkKey) {
+			continue
+		}
+
+		// the check and the buffering happen under the pending lock, which
+		// registerSink takes after registering a sink, so no event is left
+		// behind in the buffer of a registered sink.
+		w.pending.mu.Lock()
+		if !w.sinks.has(sinkKey) {
+			buffered := w.pending.add(sinkKey, o, event)
+			w.pending.mu.Unlock()
+			if !buffered {
+				log.Log.Error(nil, "sink not found", "sink", sinkKey)
 			}
+			continue
 		}
+		w.pending.mu.Unlock()
+
+		w.write(ctx, o, sinkKey, event)
 	}
 }
 
+// write writes the event of the occurrence to the sink registered under the
+// given key.
+func (w *Watcher) write(ctx context.Context, o occurrence, sinkKey string, event events.Event) {
+	found, err := w.sinks.write(ctx, sinkKey, event)
+	if !found {
+		log.Log.Error(nil, "sink not found", "sink", sinkKey)
+		return
+	}
+	if err != nil {
+		// dropped events are counted by the sink queue
+		if !errors.Is(err, queue.ErrQueueFull) {
+			log.Log.Error(err, "failed to write event to sink", "sink", sinkKey)
+		}
+		return
+	}
+	// the sinks delivering from a queue advance their checkpoint once they
+	// acknowledge the event
+	if o.kind != eventDeleted && !w.acks.tracked(sinkKey) {
+		w.marks.advance(sinkCheckpoint(sinkKey), o.event)
+	}
+}
+
+// matchExpression reports whether the event matches the expression of the
+// event set registered under the given key, events failing to evaluate
+// don't match.
+func (w *Watcher) matchExpression(key, expr string, input *expression.Input) bool {
+	if expr == "" {
+		return true
+	}
+	program, err := w.expressions.compile(key, expr)
+	if err != nil {
+		// reported in the event set status
+		return false
+	}
+	matched, err := program.Eval(input)
+	if err != nil {
+		log.Log.V(1).Info("failed to evaluate expression", "eventset", key, "error", err.Error())
+		return false
+	}
+	return matched
+}
+
+// Key returns the key the sinks and event sets are registered under in the
+// watcher. Cluster-scoped ones are keyed by their name and namespaced ones
+// by their namespace and name, names can't contain slashes so the keys
+// never collide.
+func Key(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// RegisterSink creates and starts the sink described by the given Sink. If a
+// sink with the same name is already registered it is kept when its config
+// is unchanged, otherwise it is replaced and the old sink is drained and
+// stopped. Sinks with a spool are stopped before their replacement starts,
+// their spooled events are delivered by the new sink, and are started again
+// if it fails to.
 func (w *Watcher) RegisterSink(ctx context.Context, cr v1alpha1.Sink, secretConf map[string]string) error {
-	var err error
-	var sink Sink
+	return w.registerSink(ctx, cr.Name, "", cr.Spec, secretConf)
+}
 
-	if cr.Spec.File != nil {
-		sink, err = fileSink.New(cr.Spec.File.Path)
-		if err != nil {
+// RegisterNamespacedSink registers the sink of a tenant like RegisterSink,
+// under its namespaced key. The sink is rejected if it uses anything a
+// tenant isn't allowed to, see NamespacedSink.Validate, and its dead-letter
+// sinkRef can only reference the sinks of its namespace.
+func (w *Watcher) RegisterNamespacedSink(ctx context.Context, cr v1alpha1.NamespacedSink, secretConf map[string]string) error {
+	if errs := cr.Validate(); len(errs) > 0 {
+		return errs.ToAggregate()
+	}
+	return w.registerSink(ctx, Key(cr.Namespace, cr.Name), cr.Namespace, cr.Spec, secretConf)
+}
+
+// registerSink registers the sink under the given key, namespace is the
+// namespace of namespaced sinks and empty for cluster-scoped ones.
+func (w *Watcher) registerSink(ctx context.Context, key, namespace string, spec v1alpha1.SinkSpec, secretConf map[string]string) error {
+	hash, err := sinkHash(spec, secretConf)
+	if err != nil {
+		return err
+	}
+
+	if current, ok := w.sinks.hash(key); ok && current == hash {
+		return nil
+	}
+
+	if spec.Spool != nil && spec.SQLite != nil {
+		return errors.New("spool is not supported by sqlite sinks")
+	}
+	if spillsToDisk(spec) && spec.Queue.SpillPath == "" {
+		return errors.New("spillPath is required by the SpillToDisk overflow policy")
+	}
+
+	start := func() (Sink, error) {
+		return w.startSink(ctx, key, namespace, spec, secretConf, false)
+	}
+	create := func() (Sink, error) {
+		return w.startSink(ctx, key, namespace, spec, secretConf, true)
+	}
+
+	if spec.Spool != nil || spillsToDisk(spec) {
+		// a spool can only be opened by one sink at a time, so the replaced
+		// sink releases it before the new one starts.
+		if err := w.sinks.replace(key, hash, create, start); err != nil {
 			return err
 		}
-	} else if cr.Spec.SQLite != nil {
-		sink, err = sqliteSink.New(cr.Spec.SQLite.Path)
+	} else {
+		sink, err := create()
 		if err != nil {
 			return err
 		}
-	} else if cr.Spec.Webhook != nil {
-		sink, err = webhookSink.New(cr.Spec.Webhook.Endpoint, cr.Spec.Webhook.Headers)
-		if err != nil {
-			return err
+		if old, ok := w.sinks.swap(key, hash, sink, start); ok {
+			if err := old.Stop(); err != nil {
+				log.Log.Error(err, "failed to stop replaced sink", "sink", key)
+			}
 		}
-	} else if cr.Spec.Elastic != nil {
-		cr.Spec.Elastic.SetSecretConf(secretConf)
-		sink, err = elasticSink.New(
-			cr.Spec.Elastic.Address,
-			cr.Spec.Elastic.IndexName,
-			cr.Spec.Elastic.Username,
-			cr.Spec.Elastic.Password,
-			cr.Spec.Elastic.BatchSize,
-			cr.Spec.Elastic.BatchExpiry,
-		)
+	}
+
+	w.flushPending(ctx, key)
+
+	return nil
+}
+
+// startSink creates the sink with its queue and starts it, probing its
+// backend if probe is set. The checkpoint of the sink is advanced as it
+// acknowledges the events of its queue, or as they are written for the
+// sinks without one.
+func (w *Watcher) startSink(ctx context.Context, key, namespace string, spec v1alpha1.SinkSpec, secretConf map[string]string, probe bool) (Sink, error) {
+	sinkMetrics := metrics.ForSink(key)
+
+	q, err := w.newQueue(key, spec, sinkMetrics)
+	if err != nil {
+		return nil, err
+	}
+
+	var deliverer *sinks.Deliverer
+	var tracker *ackTracker
+	if spec.SQLite == nil {
+		deliverer, err = w.newDeliverer(key, namespace, spec, sinkMetrics)
 		if err != nil {
-			return err
+			q.Close()
+			return nil, err
 		}
+		tracker = newAckTracker(w, key, spec.Spool != nil)
+		q = &trackedQueue{Queue: q, tracker: tracker}
 	}
 
-	if err := sink.Start(ctx); err != nil {
-		return err
+	sink, err := newSink(spec, secretConf, q, deliverer, sinkMetrics)
+	if err == nil {
+		err = sink.Start(ctx)
 	}
+	if err != nil {
+		q.Close()
+		if deliverer != nil {
+			deliverer.Close()
+		}
+		return nil, err
+	}
+
+	if probe {
+		if err := probeSink(ctx, sink); err != nil {
+			if err := sink.Stop(); err != nil {
+				log.Log.Error(err, "failed to stop sink", "sink", key)
+			}
+			return nil, err
+		}
+	}
+
+	w.acks.set(key, tracker)
+	return sink, nil
+}
 
-	w.sinks[cr.Name] = sink
+// probeSink checks that the sink backend is reachable if the sink supports
+// it.
+func probeSink(ctx context.Context, sink Sink) error {
+	prober, ok := sink.(Prober)
+	if !ok {
+		return nil
+	}
 
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	if err := prober.Probe(ctx); err != nil {
+		return fmt.Errorf("probe failed: %w", err)
+	}
 	return nil
 }
 
+// newDeliverer creates the deliverer retrying the failed writes of the sink.
+func (w *Watcher) newDeliverer(key, namespace string, spec v1alpha1.SinkSpec, sinkMetrics *metrics.SinkMetrics) (*sinks.Deliverer, error) {
+	opts := sinks.DelivererOptions{
+		Retries: sinks.DefaultRetries,
+		Metrics: sinkMetrics,
+	}
+	if retry := spec.Retry; retry != nil {
+		opts.Retries = retry.Retries
+		if retry.Interval != nil {
+			opts.RetryInterval = retry.Interval.Duration
+		}
+		if retry.MaxInterval != nil {
+			opts.MaxRetryInterval = retry.MaxInterval.Duration
+		}
+	}
+
+	if deadLetter := spec.DeadLetter; deadLetter != nil {
+		switch {
+		case deadLetter.SinkRef != nil:
+			target := Key(namespace, deadLetter.SinkRef.Name)
+			if target == key {
+				return nil, errors.New("a sink can't be its own dead-letter sink")
+			}
+			opts.DeadLetter = &sinkDeadLetter{
+				source:  key,
+				target:  target,
+				letters: w.deadLetters,
+			}
+		case deadLetter.Path != "":
+			file, err := sinks.NewFileDeadLetter(deadLetter.Path)
+			if err != nil {
+				return nil, err
+			}
+			opts.DeadLetter = file
+		}
+	}
+
+	return sinks.NewDeliverer(opts), nil
+}
+
+// newQueue creates the queue holding the events written to the sink until
+// they are delivered.
+func (w *Watcher) newQueue(key string, spec v1alpha1.SinkSpec, sinkMetrics *metrics.SinkMetrics) (queue.Queue, error) {
+	if spec.Spool != nil {
+		spool, err := queue.OpenSpool(spec.Spool.Path, spec.Spool.SegmentSize, sinkMetrics)
+		if err != nil {
+			return nil, err
+		}
+		return spool, nil
+	}
+
+	opts := queue.MemoryOptions{
+		OnDrop:  w.drops.onDrop(key),
+		Metrics: sinkMetrics,
+	}
+	if spec.Queue != nil {
+		opts.Size = spec.Queue.Size
+		opts.OverflowPolicy = spec.Queue.OverflowPolicy
+		if spec.Queue.BlockTimeout != nil {
+			opts.BlockTimeout = spec.Queue.BlockTimeout.Duration
+		}
+	}
+	if spillsToDisk(spec) {
+		spill, err := queue.OpenSpool(spec.Queue.SpillPath, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		opts.Spill = spill
+	}
+	return queue.NewMemory(opts), nil
+}
+
+func spillsToDisk(spec v1alpha1.SinkSpec) bool {
+	return spec.Spool == nil && spec.Queue != nil && spec.Queue.OverflowPolicy == v1alpha1.SpillToDiskOverflowPolicy
+}
+
+func newSink(spec v1alpha1.SinkSpec, secretConf map[string]string, q queue.Queue, deliverer *sinks.Deliverer, sinkMetrics *metrics.SinkMetrics) (Sink, error) {
+	switch {
+	case spec.File != nil:
+		return fileSink.New(spec.File.Path, q, deliverer)
+	case spec.SQLite != nil:
+		return sqliteSink.New(spec.SQLite.Path, sinkMetrics)
+	case spec.Webhook != nil:
+		return webhookSink.New(spec.Webhook.Endpoint, spec.Webhook.Headers, spec.Webhook.Probe, q, deliverer)
+	case spec.Elastic != nil:
+		spec.Elastic.SetSecretConf(secretConf)
+		return elasticSink.New(
+			spec.Elastic.Address,
+			spec.Elastic.IndexName,
+			spec.Elastic.Username,
+			spec.Elastic.Password,
+			spec.Elastic.BatchSize,
+			spec.Elastic.BatchExpiry,
+			q,
+			deliverer,
+		)
+	}
+	return nil, errors.New("no sink type is configured")
+}
+
+// DroppedEvents returns the number of events dropped by the named sink since
+// it was registered.
+func (w *Watcher) DroppedEvents(name string) int64 {
+	return w.drops.get(name)
+}
+
+// SinkHealth returns the delivery health of the named sink, ok is false if
+// the sink isn't registered or doesn't track its health.
+func (w *Watcher) SinkHealth(name string) (health sinks.Health, ok bool) {
+	sink, found := w.GetSink(name)
+	if !found {
+		return health, false
+	}
+	reporter, ok := sink.(HealthReporter)
+	if !ok {
+		return health, false
+	}
+	return reporter.Health(), true
+}
+
+// EventSetMatches returns the events matched by the named event set since
+// the watcher started.
+func (w *Watcher) EventSetMatches(name string) EventSetMatches {
+	return w.matches.get(name)
+}
+
+// CompileExpression compiles the expression of the named event set, it is
+// used to filter its events until the expression changes.
+func (w *Watcher) CompileExpression(name, expr string) error {
+	_, err := w.expressions.compile(name, expr)
+	return err
+}
+
+// RemoveEventSet forgets the events matched by the named event set and its
+// compiled expression and patterns.
+func (w *Watcher) RemoveEventSet(name string) {
+	w.matches.remove(name)
+	w.expressions.remove(name)
+	w.patterns.remove(name)
+}
+
+// UnwatchedNamespaces returns the namespaces that are not watched, the
+// events of which are never received.
+func (w *Watcher) UnwatchedNamespaces(namespaces []string) []string {
+	if len(w.opts.Namespaces) == 0 {
+		return nil
+	}
+	watched := make(map[string]bool, len(w.opts.Namespaces))
+	for _, namespace := range w.opts.Namespaces {
+		watched[namespace] = true
+	}
+	var unwatched []string
+	for _, namespace := range namespaces {
+		if !watched[namespace] {
+			unwatched = append(unwatched, namespace)
+		}
+	}
+	return unwatched
+}
+
+func (w *Watcher) GetSink(name string) (Sink, bool) {
+	return w.sinks.get(name)
+}
+
+// QueryableSink returns the registered sink with the given name if it
+// supports queries.
+func (w *Watcher) QueryableSink(name string) (QueryableSink, error) {
+	sink, ok := w.GetSink(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSinkNotFound, name)
+	}
+	queryable, ok := sink.(QueryableSink)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSinkNotQueryable, name)
+	}
+	return queryable, nil
+}
+
 func (w *Watcher) RemoveSink(name string) {
-	if sink, ok := w.sinks[name]; ok {
-		delete(w.sinks, name)
+	w.drops.remove(name)
+	if sink, ok := w.sinks.remove(name); ok {
 		if err := sink.Stop(); err != nil {
-			log.Log.Error(err, "failed to stop sink")
+			log.Log.Error(err, "failed to stop sink", "sink", name)
 		}
 	}
+	// a sink created again under the same name doesn't get the events
+	// buffered for the removed one.
+	w.pending.mu.Lock()
+	w.pending.take(name)
+	w.pending.mu.Unlock()
+	// removed once the sink is drained, which acknowledges its events
+	w.acks.set(name, nil)
+	w.marks.remove(sinkCheckpoint(name))
 }
+
+var (
+	_ QueryableSink = &sqliteSink.SqliteSink{}
+	_ QueryableSink = &elasticSink.ElasticSink{}
+
+	_ Prober = &fileSink.FilesystemSink{}
+	_ Prober = &sqliteSink.SqliteSink{}
+	_ Prober = &webhookSink.WebhookSink{}
+	_ Prober = &elasticSink.ElasticSink{}
+
+	_ HealthReporter = &fileSink.FilesystemSink{}
+	_ HealthReporter = &webhookSink.WebhookSink{}
+	_ HealthReporter = &elasticSink.ElasticSink{}
+)
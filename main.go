@@ -19,19 +19,28 @@ package main
 import (
 	"flag"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	v1alpha1 "github.com/ahsayde/analytics-controller/api/v1alpha1"
 	"github.com/ahsayde/analytics-controller/controllers"
+	"github.com/ahsayde/analytics-controller/internal/checkpoint"
+	"github.com/ahsayde/analytics-controller/internal/server"
 	"github.com/ahsayde/analytics-controller/internal/watcher"
+	"github.com/ahsayde/analytics-controller/pkg/events"
 
 	analyticsweaveworksv1alpha1 "github.com/ahsayde/analytics-controller/api/v1alpha1"
 	//+kubebuilder:scaffold:imports
@@ -53,8 +62,50 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var queryAddr string
+	var queryCertDir string
+	var pendingEventsPolicy string
+	var pendingEventsBufferSize int
+	var startupPolicy string
+	var checkpointConfigMap string
+	var checkpointInterval time.Duration
+	var enableWebhooks bool
+	var eventsAPIVersion string
+	var watchNamespaces string
+	var labelSelectorKinds string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.StringVar(&queryAddr, "query-bind-address", "0", "The address the sink query endpoint binds to, for example :8082. "+
+		"Requests are authorized with the token they bear. Set to 0 to disable it.")
+	flag.StringVar(&queryCertDir, "query-cert-dir", filepath.Join(os.TempDir(), "k8s-webhook-server", "serving-certs"),
+		"The directory holding the tls.crt and tls.key certificate the sink query endpoint is served with, "+
+			"the webhook server cert directory by default.")
+	flag.StringVar(&pendingEventsPolicy, "pending-events-policy", string(watcher.BufferPendingEvents),
+		"What to do with the events matched for a sinkRef while no sink is registered for it, one of Buffer or Drop. "+
+			"Buffered events are dropped after 30 minutes.")
+	flag.IntVar(&pendingEventsBufferSize, "pending-events-buffer-size", watcher.DefaultPendingEventsBufferSize,
+		"Maximum number of events buffered for each sink while it is not registered.")
+	flag.StringVar(&startupPolicy, "startup-policy", v1alpha1.ReplayAllStartupPolicy,
+		"Which of the events found in the cluster on startup are delivered, one of Skip, ReplayAll or SinceCheckpoint. "+
+			"Event sets can override it with spec.startupPolicy.")
+	flag.StringVar(&checkpointConfigMap, "checkpoint-configmap", "",
+		"The namespace/name of the ConfigMap storing the delivery checkpoints of the sinks. Checkpoints are disabled if empty.")
+	flag.DurationVar(&checkpointInterval, "checkpoint-interval", watcher.DefaultCheckpointInterval,
+		"The interval between delivery checkpoint saves.")
+	flag.StringVar(&eventsAPIVersion, "events-api-version", events.CoreV1,
+		"The API version the events are watched with, one of v1 or events.k8s.io/v1. "+
+			"Both serve the same events, only the selected one is watched so that no event is delivered twice.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma separated list of the namespaces the events are watched in, all namespaces if empty. "+
+			"The namespaced objects read by the controller, such as the secrets referenced by the sinks and "+
+			"the checkpoint ConfigMap, must be in one of them.")
+	flag.StringVar(&labelSelectorKinds, "label-selector-kinds", "v1/Pod",
+		"Comma separated list of the apiVersion/kind of the involved objects the object selectors of the event sets match, "+
+			"for example v1/Pod,apps/v1/Deployment. Their metadata is cached once an event set selects them and "+
+			"the controller must be allowed to list and watch them.")
+	flag.BoolVar(&enableWebhooks, "enable-webhooks", false,
+		"Enable the admission webhooks validating the event sets and namespaced sinks, they are served on port 9443 "+
+			"with the certificates found in the webhook server cert directory.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -66,32 +117,100 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	var namespaces []string
+	for _, namespace := range strings.Split(watchNamespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	var kinds []schema.GroupVersionKind
+	for _, kind := range strings.Split(labelSelectorKinds, ",") {
+		if kind = strings.TrimSpace(kind); kind == "" {
+			continue
+		}
+		slash := strings.LastIndex(kind, "/")
+		if slash <= 0 || slash == len(kind)-1 {
+			setupLog.Error(nil, "label selector kinds must be in the apiVersion/kind format", "kind", kind)
+			os.Exit(1)
+		}
+		kinds = append(kinds, schema.FromAPIVersionAndKind(kind[:slash], kind[slash+1:]))
+	}
+
+	mgrOpts := ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
-	})
+	}
+	if len(namespaces) > 0 {
+		mgrOpts.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), mgrOpts)
 
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	if err = (&controllers.AnalyticReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "Analytic")
+	policy := watcher.PendingEventsPolicy(pendingEventsPolicy)
+	if policy != watcher.BufferPendingEvents && policy != watcher.DropPendingEvents {
+		setupLog.Error(nil, "invalid pending events policy", "policy", pendingEventsPolicy)
 		os.Exit(1)
 	}
 
-	watcher := watcher.New(mgr)
+	switch startupPolicy {
+	case v1alpha1.SkipStartupPolicy, v1alpha1.ReplayAllStartupPolicy, v1alpha1.SinceCheckpointStartupPolicy:
+	default:
+		setupLog.Error(nil, "invalid startup policy", "policy", startupPolicy)
+		os.Exit(1)
+	}
+
+	if _, err := events.NewObject(eventsAPIVersion); err != nil {
+		setupLog.Error(err, "invalid events API version")
+		os.Exit(1)
+	}
+
+	var checkpoints *checkpoint.Store
+	if checkpointConfigMap != "" {
+		namespace, name, ok := strings.Cut(checkpointConfigMap, "/")
+		if !ok || namespace == "" || name == "" {
+			setupLog.Error(nil, "checkpoint configmap must be in the namespace/name format", "configmap", checkpointConfigMap)
+			os.Exit(1)
+		}
+		if len(namespaces) > 0 && !contains(namespaces, namespace) {
+			setupLog.Error(nil, "checkpoint configmap must be in one of the watched namespaces", "configmap", checkpointConfigMap)
+			os.Exit(1)
+		}
+		checkpoints = checkpoint.NewStore(mgr.GetClient(), mgr.GetAPIReader(), types.NamespacedName{
+			Namespace: namespace,
+			Name:      name,
+		})
+	}
+
+	watcher := watcher.New(mgr, watcher.Options{
+		PendingEventsPolicy:     policy,
+		PendingEventsBufferSize: pendingEventsBufferSize,
+		StartupPolicy:           startupPolicy,
+		Checkpoints:             checkpoints,
+		CheckpointInterval:      checkpointInterval,
+		EventsAPIVersion:        eventsAPIVersion,
+		Namespaces:              namespaces,
+		LabelSelectorKinds:      kinds,
+	})
 	if err := mgr.Add(watcher); err != nil {
 		setupLog.Error(err, "unable to add event watcher")
 		os.Exit(1)
 	}
 
+	if queryAddr != "0" {
+		if err := mgr.Add(server.NewQueryServer(queryAddr, queryCertDir, watcher, mgr.GetClient())); err != nil {
+			setupLog.Error(err, "unable to add query server")
+			os.Exit(1)
+		}
+	}
+
 	if err = (&controllers.SinkReconciler{
 		Client:  mgr.GetClient(),
 		Scheme:  mgr.GetScheme(),
@@ -100,6 +219,57 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "Sink")
 		os.Exit(1)
 	}
+
+	if err = (&controllers.EventSetReconciler{
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Watcher: watcher,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "EventSet")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.NamespacedSinkReconciler{
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Watcher: watcher,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "NamespacedSink")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.NamespacedEventSetReconciler{
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Watcher: watcher,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "NamespacedEventSet")
+		os.Exit(1)
+	}
+
+	if enableWebhooks {
+		if err = (&v1alpha1.EventSet{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "EventSet")
+			os.Exit(1)
+		}
+		if err = (&v1alpha1.NamespacedSink{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "NamespacedSink")
+			os.Exit(1)
+		}
+		if err = (&v1alpha1.NamespacedEventSet{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "NamespacedEventSet")
+			os.Exit(1)
+		}
+	}
+
+	if err = (&controllers.AnalyticReconciler{
+		Client:  mgr.GetClient(),
+		Scheme:  mgr.GetScheme(),
+		Watcher: watcher,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Analytic")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -117,3 +287,12 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+// Package events defines the normalized event delivered to the sinks, which
+// the core/v1 and events.k8s.io/v1 events are converted into.
+package events
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// CoreV1 is the API version of the core/v1 events.
+	CoreV1 = "v1"
+	// EventsV1 is the API version of the events.k8s.io/v1 events.
+	EventsV1 = "events.k8s.io/v1"
+)
+
+// Event is an event normalized from either API version. Its fields keep the
+// JSON names of the core/v1 Event, so that the documents written by the
+// sinks don't depend on the API version the event was read from and the
+// events spooled by earlier versions can still be read.
+type Event struct {
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// APIVersion is the API version the event was read from.
+	APIVersion string `json:"apiVersion,omitempty"`
+
+	// Type of the event, Normal or Warning.
+	Type string `json:"type,omitempty"`
+
+	// Reason why the action was taken.
+	Reason string `json:"reason,omitempty"`
+
+	// Action taken or failed regarding the involved object.
+	Action string `json:"action,omitempty"`
+
+	// Message is the core/v1 message or the events.k8s.io/v1 note.
+	Message string `json:"message,omitempty"`
+
+	// InvolvedObject is the core/v1 involved object or the events.k8s.io/v1
+	// regarding object.
+	InvolvedObject v1.ObjectReference `json:"involvedObject"`
+
+	// Related is the secondary object of the event.
+	Related *v1.ObjectReference `json:"related,omitempty"`
+
+	// Source is the core/v1 source or the events.k8s.io/v1 deprecated
+	// source.
+	Source v1.EventSource `json:"source,omitempty"`
+
+	// ReportingController is the controller that emitted the event.
+	ReportingController string `json:"reportingComponent,omitempty"`
+
+	// ReportingInstance is the instance of the controller that emitted the
+	// event.
+	ReportingInstance string `json:"reportingInstance,omitempty"`
+
+	// Count is the number of times the event occurred, taken from its
+	// series if it has one, it is at least 1.
+	Count int32 `json:"count,omitempty"`
+
+	// FirstTimestamp is the time the event first occurred.
+	FirstTimestamp metav1.Time `json:"firstTimestamp,omitempty"`
+
+	// LastTimestamp is the time the event last occurred, taken from its
+	// series if it has one.
+	LastTimestamp metav1.Time `json:"lastTimestamp,omitempty"`
+
+	// EventTime is the time the event was first observed by the
+	// events.k8s.io/v1 API.
+	EventTime metav1.MicroTime `json:"eventTime,omitempty"`
+}
+
+// FromCoreV1 normalizes a core/v1 event.
+func FromCoreV1(event *v1.Event) Event {
+	normalized := Event{
+		ObjectMeta:          *event.ObjectMeta.DeepCopy(),
+		APIVersion:          CoreV1,
+		Type:                event.Type,
+		Reason:              event.Reason,
+		Action:              event.Action,
+		Message:             event.Message,
+		InvolvedObject:      event.InvolvedObject,
+		Related:             copyReference(event.Related),
+		Source:              event.Source,
+		ReportingController: event.ReportingController,
+		ReportingInstance:   event.ReportingInstance,
+		Count:               event.Count,
+		FirstTimestamp:      event.FirstTimestamp,
+		LastTimestamp:       event.LastTimestamp,
+		EventTime:           event.EventTime,
+	}
+	if series := event.Series; series != nil {
+		if series.Count > normalized.Count {
+			normalized.Count = series.Count
+		}
+		if !series.LastObservedTime.IsZero() {
+			normalized.LastTimestamp = metav1.NewTime(series.LastObservedTime.Time)
+		}
+	}
+	normalized.normalize()
+	return normalized
+}
+
+// FromEventsV1 normalizes an events.k8s.io/v1 event.
+func FromEventsV1(event *eventsv1.Event) Event {
+	normalized := Event{
+		ObjectMeta:          *event.ObjectMeta.DeepCopy(),
+		APIVersion:          EventsV1,
+		Type:                event.Type,
+		Reason:              event.Reason,
+		Action:              event.Action,
+		Message:             event.Note,
+		InvolvedObject:      event.Regarding,
+		Related:             copyReference(event.Related),
+		Source:              event.DeprecatedSource,
+		ReportingController: event.ReportingController,
+		ReportingInstance:   event.ReportingInstance,
+		Count:               event.DeprecatedCount,
+		FirstTimestamp:      event.DeprecatedFirstTimestamp,
+		LastTimestamp:       event.DeprecatedLastTimestamp,
+		EventTime:           event.EventTime,
+	}
+	if series := event.Series; series != nil {
+		if series.Count > normalized.Count {
+			normalized.Count = series.Count
+		}
+		if !series.LastObservedTime.IsZero() {
+			normalized.LastTimestamp = metav1.NewTime(series.LastObservedTime.Time)
+		}
+	}
+	normalized.normalize()
+	return normalized
+}
+
+// normalize fills the count and timestamps the event was created without.
+func (e *Event) normalize() {
+	if e.Count == 0 {
+		e.Count = 1
+	}
+	if e.FirstTimestamp.IsZero() {
+		switch {
+		case !e.EventTime.IsZero():
+			e.FirstTimestamp = metav1.NewTime(e.EventTime.Time)
+		default:
+			e.FirstTimestamp = e.CreationTimestamp
+		}
+	}
+	if e.LastTimestamp.IsZero() {
+		e.LastTimestamp = e.FirstTimestamp
+	}
+}
+
+func copyReference(ref *v1.ObjectReference) *v1.ObjectReference {
+	if ref == nil {
+		return nil
+	}
+	copied := *ref
+	return &copied
+}
+
+// DeepCopy returns a copy of the event sharing no memory with it.
+func (e *Event) DeepCopy() *Event {
+	if e == nil {
+		return nil
+	}
+	out := *e
+	e.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Related = copyReference(e.Related)
+	e.FirstTimestamp.DeepCopyInto(&out.FirstTimestamp)
+	e.LastTimestamp.DeepCopyInto(&out.LastTimestamp)
+	e.EventTime.DeepCopyInto(&out.EventTime)
+	return &out
+}
+
+// NewObject returns an empty event of the given API version, to get its
+// informer from the cache.
+func NewObject(apiVersion string) (client.Object, error) {
+	switch apiVersion {
+	case CoreV1:
+		return &v1.Event{}, nil
+	case EventsV1:
+		return &eventsv1.Event{}, nil
+	}
+	return nil, fmt.Errorf("unsupported events API version %q, expected %s or %s", apiVersion, CoreV1, EventsV1)
+}
+
+// FromObject normalizes an event of either API version, ok is false if the
+// object isn't an event.
+func FromObject(obj interface{}) (event *Event, ok bool) {
+	var normalized Event
+	switch e := obj.(type) {
+	case *v1.Event:
+		normalized = FromCoreV1(e)
+	case *eventsv1.Event:
+		normalized = FromEventsV1(e)
+	default:
+		return nil, false
+	}
+	return &normalized, true
+}
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	eventsv1 "k8s.io/api/events/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFromEventsV1(t *testing.T) {
+	first := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+	last := first.Add(time.Hour)
+
+	event := FromEventsV1(&eventsv1.Event{
+		EventTime:           metav1.NewMicroTime(first),
+		Series:              &eventsv1.EventSeries{Count: 12, LastObservedTime: metav1.NewMicroTime(last)},
+		ReportingController: "kustomize-controller",
+		Reason:              "ReconciliationSucceeded",
+		Regarding:           v1.ObjectReference{Kind: "Kustomization", Name: "apps"},
+		Related:             &v1.ObjectReference{Kind: "GitRepository", Name: "flux-system"},
+		Note:                "Applied revision main/abc",
+		DeprecatedCount:     1,
+	})
+
+	if event.APIVersion != EventsV1 {
+		t.Errorf("expected api version %s, got %s", EventsV1, event.APIVersion)
+	}
+	if event.Message != "Applied revision main/abc" {
+		t.Errorf("expected the note as message, got %q", event.Message)
+	}
+	if event.InvolvedObject.Name != "apps" || event.Related.Name != "flux-system" {
+		t.Errorf("unexpected objects %v and %v", event.InvolvedObject, event.Related)
+	}
+	if event.Count != 12 {
+		t.Errorf("expected the series count 12, got %d", event.Count)
+	}
+	if !event.FirstTimestamp.Time.Equal(first) || !event.LastTimestamp.Time.Equal(last) {
+		t.Errorf("expected timestamps %s and %s, got %s and %s", first, last, event.FirstTimestamp, event.LastTimestamp)
+	}
+}
+
+func TestFromCoreV1(t *testing.T) {
+	created := time.Date(2023, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	event := FromCoreV1(&v1.Event{
+		ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(created)},
+		Reason:     "Scheduled",
+	})
+	if event.Count != 1 {
+		t.Errorf("expected events without count to have occurred once, got %d", event.Count)
+	}
+	if !event.FirstTimestamp.Time.Equal(created) || !event.LastTimestamp.Time.Equal(created) {
+		t.Errorf("expected the creation time as timestamps, got %s and %s", event.FirstTimestamp, event.LastTimestamp)
+	}
+
+	last := created.Add(time.Minute)
+	event = FromCoreV1(&v1.Event{
+		Count:          2,
+		FirstTimestamp: metav1.NewTime(created),
+		LastTimestamp:  metav1.NewTime(created),
+		Series:         &v1.EventSeries{Count: 5, LastObservedTime: metav1.NewMicroTime(last)},
+	})
+	if event.Count != 5 || !event.LastTimestamp.Time.Equal(last) {
+		t.Errorf("expected the series count and time, got %d and %s", event.Count, event.LastTimestamp)
+	}
+}